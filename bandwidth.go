@@ -0,0 +1,283 @@
+package sdp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BandwidthCT   = "CT"   // Conference Total, kbps [RFC8866]
+	BandwidthAS   = "AS"   // Application Specific, kbps [RFC8866]
+	BandwidthTIAS = "TIAS" // Transport Independent Application Specific, bps [RFC3890]
+	BandwidthRS   = "RS"   // RTCP senders, bps [RFC3556]
+	BandwidthRR   = "RR"   // RTCP receivers, bps [RFC3556]
+)
+
+// Bounds used to detect values given in the wrong unit.
+const (
+	maxKbpsValue = 100_000_000 // 100 Gbps expressed in kbps
+	minTIASValue = 1000        // TIAS below 1 kbps is most likely given in kbps
+)
+
+// Unit returns the unit of the bandwidth value: "kbps" for CT and AS, "bps" for TIAS, RS and RR,
+// and "" for unknown modifiers.
+func (b *Bandwidth) Unit() string {
+	switch b.Type {
+	case BandwidthCT, BandwidthAS:
+		return "kbps"
+	case BandwidthTIAS, BandwidthRS, BandwidthRR:
+		return "bps"
+	}
+	return ""
+}
+
+// BitsPerSecond returns the bandwidth value in bps, and false for unknown modifiers.
+func (b *Bandwidth) BitsPerSecond() (int, bool) {
+	switch b.Unit() {
+	case "kbps":
+		return b.Value * 1000, true
+	case "bps":
+		return b.Value, true
+	}
+	return 0, false
+}
+
+// Validate checks the modifier is known (or an "X-" extension) and the value plausible for its unit.
+func (b *Bandwidth) Validate() error {
+	if b.Value < 0 {
+		return fmt.Errorf("negative bandwidth b=%s:%d", b.Type, b.Value)
+	}
+	switch b.Type {
+	case BandwidthCT, BandwidthAS:
+		if b.Value > maxKbpsValue {
+			return fmt.Errorf("bandwidth b=%s:%d exceeds %d kbps, value likely given in bps", b.Type, b.Value, maxKbpsValue)
+		}
+	case BandwidthTIAS:
+		if b.Value > 0 && b.Value < minTIASValue {
+			return fmt.Errorf("bandwidth b=%s:%d below %d bps, value likely given in kbps", b.Type, b.Value, minTIASValue)
+		}
+	case BandwidthRS, BandwidthRR:
+	default:
+		if !strings.HasPrefix(b.Type, "X-") {
+			return fmt.Errorf("unknown bandwidth modifier %s", b.Type)
+		}
+	}
+	return nil
+}
+
+// GetBandwidth returns the first bandwidth value of the given modifier in its own unit.
+func GetBandwidth(bws []*Bandwidth, typ string) (int, bool) {
+	for _, bw := range bws {
+		if bw.Type == typ {
+			return bw.Value, true
+		}
+	}
+	return 0, false
+}
+
+// EffectiveBandwidth returns the bandwidth in bps that applies to media m and the modifier it comes from:
+// its own b=AS, else the session b=AS, capped by the session b=CT, at the IP layer.
+// Without any AS or CT, the media (or session) b=TIAS is returned, which excludes the IP, UDP and
+// RTP overhead. It returns 0 and "" if unknown or m is nil.
+func (ses *Session) EffectiveBandwidth(m *Media) (int, string) {
+	if m == nil {
+		return 0, ""
+	}
+	typ := BandwidthAS
+	bw, ok := GetBandwidth(m.Bandwidth, BandwidthAS)
+	if !ok {
+		bw, ok = GetBandwidth(ses.Bandwidth, BandwidthAS)
+	}
+	bw *= 1000
+	if ct, found := GetBandwidth(ses.Bandwidth, BandwidthCT); found {
+		if ct *= 1000; !ok || ct < bw {
+			bw, ok, typ = ct, true, BandwidthCT
+		}
+	}
+	if ok {
+		return bw, typ
+	}
+	tias, found := GetBandwidth(m.Bandwidth, BandwidthTIAS)
+	if !found {
+		tias, found = GetBandwidth(ses.Bandwidth, BandwidthTIAS)
+	}
+	if !found {
+		return 0, ""
+	}
+	return tias, BandwidthTIAS
+}
+
+// ScaleBandwidth multiplies every bandwidth value of the session and its media by factor.
+func (ses *Session) ScaleBandwidth(factor float64) *Session {
+	scale := func(bws []*Bandwidth) {
+		for _, bw := range bws {
+			bw.Value = int(float64(bw.Value) * factor)
+		}
+	}
+	scale(ses.Bandwidth)
+	for _, m := range ses.Media {
+		scale(m.Bandwidth)
+	}
+	return ses
+}
+
+// CapBandwidth limits every CT and AS line to maxKbps and every TIAS line to the same limit in bps.
+// RS and RR lines are reduced in the same proportion as the AS (or CT) line they accompany.
+func (ses *Session) CapBandwidth(maxKbps int) *Session {
+	capBandwidth(ses.Bandwidth, maxKbps)
+	for _, m := range ses.Media {
+		capBandwidth(m.Bandwidth, maxKbps)
+	}
+	return ses
+}
+
+func capBandwidth(bws []*Bandwidth, maxKbps int) {
+	ratio := 1.0
+	for _, bw := range bws {
+		switch bw.Type {
+		case BandwidthCT, BandwidthAS:
+			if bw.Value > maxKbps {
+				ratio = min(ratio, float64(maxKbps)/float64(bw.Value))
+				bw.Value = maxKbps
+			}
+		case BandwidthTIAS:
+			bw.Value = min(bw.Value, maxKbps*1000)
+		}
+	}
+	for _, bw := range bws {
+		switch bw.Type {
+		case BandwidthRS, BandwidthRR:
+			bw.Value = int(float64(bw.Value) * ratio)
+		}
+	}
+}
+
+// Per packet header sizes in bytes.
+const (
+	headerIPv4 = 20
+	headerIPv6 = 40
+	headerUDP  = 8
+	headerRTP  = 12
+
+	SRTPAuthTag80 = 10 // AES_CM_128_HMAC_SHA1_80
+	SRTPAuthTag32 = 4  // AES_CM_128_HMAC_SHA1_32
+)
+
+// FlowOverhead describes the transport below the RTP payload of a flow.
+type FlowOverhead struct {
+	IPv6        bool
+	SRTPAuthTag int // SRTP authentication tag length in bytes, 0 for plain RTP
+}
+
+// PerPacket returns the IP, UDP and RTP header bytes added to every packet.
+func (o FlowOverhead) PerPacket() int {
+	n := headerUDP + headerRTP + o.SRTPAuthTag
+	if o.IPv6 {
+		return n + headerIPv6
+	}
+	return n + headerIPv4
+}
+
+// FlowBitrate is the bitrate of one RTP flow in one direction.
+type FlowBitrate struct {
+	PacketsPerSecond float64
+	PayloadBitrate   int // RTP payload bits per second
+	IPBitrate        int // IP layer bits per second, including all headers
+}
+
+// CalculateBitrate computes the bitrate of a flow of format f sent every ptime.
+// Variable rate codecs need a "maxaveragebitrate" fmtp parameter (as opus does) to be calculated.
+func CalculateBitrate(f *Format, ptime time.Duration, o FlowOverhead) (*FlowBitrate, error) {
+	timing, err := GetRTPTiming(f, ptime)
+	if err != nil {
+		return nil, err
+	}
+	pps := float64(time.Second) / float64(ptime)
+	payload := int(float64(timing.PayloadBytes*8)*pps + 0.5)
+	if timing.PayloadBytes == 0 {
+		v, ok := f.FmtpParams()["maxaveragebitrate"]
+		if !ok {
+			return nil, fmt.Errorf("cannot calculate bitrate of variable rate codec %s", f.Name)
+		}
+		if payload, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid maxaveragebitrate for %s: %w", f.Name, err)
+		}
+	}
+	return &FlowBitrate{
+		PacketsPerSecond: pps,
+		PayloadBitrate:   payload,
+		IPBitrate:        payload + int(pps*float64(o.PerPacket()*8)+0.5),
+	}, nil
+}
+
+// Bandwidth returns the matching b=AS, b=TIAS (RFC 3890) and b=RS/b=RR (RFC 3556) lines.
+// RTCP bandwidth follows the RFC 3550 default of 5% of AS, a quarter of it for senders.
+func (fb *FlowBitrate) Bandwidth() []*Bandwidth {
+	as := (fb.IPBitrate + 999) / 1000
+	return []*Bandwidth{
+		{Type: BandwidthAS, Value: as},
+		{Type: BandwidthTIAS, Value: fb.PayloadBitrate},
+		{Type: BandwidthRS, Value: as * 1000 / 80},
+		{Type: BandwidthRR, Value: as * 1000 * 3 / 80},
+	}
+}
+
+// BuildBandwidth computes the b= lines for format f sent every ptime over the given transport.
+func BuildBandwidth(f *Format, ptime time.Duration, o FlowOverhead) ([]*Bandwidth, error) {
+	fb, err := CalculateBitrate(f, ptime, o)
+	if err != nil {
+		return nil, err
+	}
+	return fb.Bandwidth(), nil
+}
+
+// BestFormatWithinBandwidth returns the first media codec, in preference order, whose flow fits the
+// bandwidth budget of m: media b=AS and b=TIAS, or session b=AS and b=CT when the media has none.
+// Codecs whose bitrate cannot be calculated are skipped.
+func (ses *Session) BestFormatWithinBandwidth(m *Media, o FlowOverhead) (*Format, error) {
+	if m == nil {
+		return nil, fmt.Errorf("cannot select codec: no media")
+	}
+	ptime := ses.EffectivePTime(m)
+	if ptime == 0 {
+		ptime = DefaultPTime
+	}
+	ipBudget, payloadBudget := bandwidthBudget(m.Bandwidth)
+	if ipBudget == 0 && payloadBudget == 0 {
+		ipBudget, _ = bandwidthBudget(ses.Bandwidth)
+	}
+	for _, f := range m.Formats {
+		f := resolveStatic(f)
+		if !f.IsAudioFormat() || isReferencingFormat(f) {
+			continue
+		}
+		fb, err := CalculateBitrate(f, ptime, o)
+		if err != nil {
+			continue
+		}
+		if ipBudget > 0 && fb.IPBitrate > ipBudget || payloadBudget > 0 && fb.PayloadBitrate > payloadBudget {
+			continue
+		}
+		return m.FormatByPayload(f.Payload), nil
+	}
+	return nil, fmt.Errorf("no %s codec fits the bandwidth budget", m.Type)
+}
+
+// bandwidthBudget returns the tightest IP layer and payload budgets in bps from the b= lines.
+func bandwidthBudget(bws []*Bandwidth) (ip, payload int) {
+	for _, bw := range bws {
+		switch bw.Type {
+		case BandwidthAS, BandwidthCT:
+			if v := bw.Value * 1000; ip == 0 || v < ip {
+				ip = v
+			}
+		case BandwidthTIAS:
+			if payload == 0 || bw.Value < payload {
+				payload = bw.Value
+			}
+		}
+	}
+	return
+}
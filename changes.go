@@ -0,0 +1,178 @@
+package sdp
+
+import "strings"
+
+// ReOfferChange is a set of changes between two remote descriptions of a dialog.
+type ReOfferChange uint
+
+const (
+	ChangeHold ReOfferChange = 1 << iota
+	ChangeResume
+	ChangeCodec
+	ChangeAddress // connection address or port
+	ChangeStreamAdded
+	ChangeStreamRemoved
+	ChangeICERestart
+	ChangeCryptoRekey
+	ChangeBandwidth
+	ChangeOther // any other difference, e.g. an unrelated attribute
+
+	ChangeNone ReOfferChange = 0 // session refresh
+)
+
+var reOfferChangeNames = []string{
+	"hold", "resume", "codec", "address", "stream-added", "stream-removed",
+	"ice-restart", "crypto-rekey", "bandwidth", "other",
+}
+
+// Has reports whether all changes of flag are present.
+func (c ReOfferChange) Has(flag ReOfferChange) bool {
+	return c&flag == flag
+}
+
+// IsRefresh reports whether the description did not change (a session refresh).
+func (c ReOfferChange) IsRefresh() bool {
+	return c == ChangeNone
+}
+
+// OnlyBandwidth reports whether the bandwidth is the only change.
+func (c ReOfferChange) OnlyBandwidth() bool {
+	return c == ChangeBandwidth
+}
+
+// TouchesMedia reports whether the RTP relay must be updated for these changes.
+func (c ReOfferChange) TouchesMedia() bool {
+	return c&(ChangeCodec|ChangeAddress|ChangeStreamAdded|ChangeStreamRemoved|ChangeICERestart|ChangeCryptoRekey) != 0
+}
+
+func (c ReOfferChange) String() string {
+	if c == ChangeNone {
+		return "refresh"
+	}
+	var names []string
+	for i, name := range reOfferChangeNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ClassifyReOffer classifies what changed in the new remote description next of a dialog
+// compared to the previous one prev. Unchanged descriptions (as per Equals) are a session refresh.
+// A nil prev, i.e. a first offer, is a new session whose streams are all added; a nil next removes them.
+func ClassifyReOffer(prev, next *Session) ReOfferChange {
+	switch {
+	case prev == next:
+		return ChangeNone
+	case prev == nil:
+		return ChangeStreamAdded
+	case next == nil:
+		return ChangeStreamRemoved
+	case prev.Equals(next):
+		return ChangeNone
+	}
+	var c ReOfferChange
+
+	if !compareBandwidths(prev.Bandwidth, next.Bandwidth) {
+		c |= ChangeBandwidth
+	}
+
+	n := min(len(prev.Media), len(next.Media))
+	if len(next.Media) > n {
+		c |= ChangeStreamAdded
+	}
+	if len(prev.Media) > n {
+		c |= ChangeStreamRemoved
+	}
+
+	for i := range n {
+		mp, mn := prev.Media[i], next.Media[i]
+		switch {
+		case mp.Port == 0 && mn.Port == 0:
+			continue
+		case mp.Port == 0:
+			c |= ChangeStreamAdded
+			continue
+		case mn.Port == 0:
+			c |= ChangeStreamRemoved
+			continue
+		case mp.Type != mn.Type || mp.Proto != mn.Proto:
+			c |= ChangeStreamRemoved | ChangeStreamAdded
+			continue
+		}
+		c |= classifyMediaChange(prev, next, mp, mn)
+	}
+
+	if c == ChangeNone {
+		// e.g. session level attributes, or a session c= line overridden by every media line
+		c = ChangeOther
+	}
+	return c
+}
+
+func classifyMediaChange(prev, next *Session, mp, mn *Media) ReOfferChange {
+	var c ReOfferChange
+
+	wasHeld, isHeld := prev.ClassifyHold(mp).IsHeld(), next.ClassifyHold(mn).IsHeld()
+	switch {
+	case !wasHeld && isHeld:
+		c |= ChangeHold
+	case wasHeld && !isHeld:
+		c |= ChangeResume
+	}
+
+	// a legacy 0.0.0.0 hold or resume is not an address change
+	addrPrev, addrNext := prev.GetEffectiveMediaIPv4(mp), next.GetEffectiveMediaIPv4(mn)
+	if mp.Port != mn.Port || addrPrev != addrNext && !isNullAddress(addrPrev) && !isNullAddress(addrNext) {
+		c |= ChangeAddress
+	}
+
+	if len(mp.Formats) != len(mn.Formats) || mp.FormatDescr != mn.FormatDescr {
+		c |= ChangeCodec
+	} else {
+		for i := range mp.Formats {
+			if !compareFormats(mp.Formats[i], mn.Formats[i]) {
+				c |= ChangeCodec
+				break
+			}
+		}
+	}
+
+	if prev.effectiveAttr(mp, "ice-ufrag") != next.effectiveAttr(mn, "ice-ufrag") ||
+		prev.effectiveAttr(mp, "ice-pwd") != next.effectiveAttr(mn, "ice-pwd") {
+		c |= ChangeICERestart
+	}
+
+	if !compareStringSlices(attrValues(mp.Attributes, "crypto"), attrValues(mn.Attributes, "crypto")) ||
+		prev.effectiveAttr(mp, "fingerprint") != next.effectiveAttr(mn, "fingerprint") {
+		c |= ChangeCryptoRekey
+	}
+
+	if !compareBandwidths(mp.Bandwidth, mn.Bandwidth) {
+		c |= ChangeBandwidth
+	}
+
+	if c == ChangeNone && !mp.Equals(mn) {
+		c |= ChangeOther
+	}
+	return c
+}
+
+// effectiveAttr returns the media attribute value, or the session level one when the media has none.
+func (ses *Session) effectiveAttr(m *Media, name string) string {
+	if m.Attributes.Has(name) {
+		return m.Attributes.Get(name)
+	}
+	return ses.Attributes.Get(name)
+}
+
+func attrValues(attrs Attributes, name string) []string {
+	var values []string
+	for _, a := range attrs {
+		if a.Name == name {
+			values = append(values, a.Value)
+		}
+	}
+	return values
+}
@@ -1,6 +1,7 @@
 package sdp
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -33,6 +34,9 @@ const (
 	RFC4733PT uint8 = 101
 )
 
+// errNoFrameSize is returned by FrameSize for codecs without a frame size model.
+var errNoFrameSize = errors.New("frame size not implemented")
+
 var (
 	SupportedCodecsStringList = []string{"opus", "G722", "PCMA", "PCMU"} // "G729"
 )
@@ -145,8 +149,14 @@ var amrWBFrameSizes = map[float64]int{
 //   - G.723: 6.3 or 5.3 (kbps)
 //   - AMR: one of {4.75, 5.15, 5.90, 6.70, 7.40, 7.95, 10.2, 12.2}
 //   - AMR-WB: one of {6.60, 8.85, 12.65, 14.25, 15.85, 18.25, 19.85, 23.05, 23.85}
+//
+// The codec name is matched case-insensitively against the codec table (e.g. "opus", "pcma").
 func FrameSize(c CodecInfo, frameDurationMs int, modeKbps float64) (int, error) {
-	switch c.Name {
+	name := c.Name
+	if cinfo, ok := GetCodecByName(name); ok {
+		name = cinfo.Name
+	}
+	switch name {
 	// --- Waveform codecs ---
 	case "PCMU", "PCMA": // 8-bit log PCM @ 8 kHz
 		samples := (c.ClockRate * frameDurationMs / 1000) * c.Channels
@@ -228,7 +238,7 @@ func FrameSize(c CodecInfo, frameDurationMs int, modeKbps float64) (int, error)
 		}
 		return 0, fmt.Errorf("unsupported AMR-WB mode %.2f kbps", modeKbps)
 
-	case "Opus":
+	case "opus":
 		// Valid durations: 2.5, 5, 10, 20, 40, 60 ms
 		switch frameDurationMs {
 		case 2, 5, 10, 20, 40, 60:
@@ -265,7 +275,7 @@ func FrameSize(c CodecInfo, frameDurationMs int, modeKbps float64) (int, error)
 		return 0, nil
 
 	default:
-		return 0, fmt.Errorf("frame size not implemented for codec %s", c.Name)
+		return 0, fmt.Errorf("%w for codec %s", errNoFrameSize, c.Name)
 	}
 }
 
@@ -11,7 +11,7 @@ func (ses *Session) Equals(other *Session) bool {
 	}
 
 	if ses.Version != other.Version || ses.Name != other.Name || ses.Information != other.Information ||
-		ses.URI != other.URI || ses.Mode != other.Mode || ses.PTime != other.PTime {
+		ses.URI != other.URI || ses.Mode != other.Mode || ses.PTime != other.PTime || ses.MaxPTime != other.MaxPTime {
 		return false
 	}
 
@@ -54,6 +54,18 @@ func (ses *Session) Equals(other *Session) bool {
 	return true
 }
 
+// EqualsWith reports whether the sessions are equal under the given options, i.e. Diff finds no change.
+// Without options every field is compared, including the origin version and the case of attribute names.
+func (ses *Session) EqualsWith(other *Session, opts ...CompareOption) bool {
+	if ses == other {
+		return true
+	}
+	if ses == nil || other == nil {
+		return false
+	}
+	return len(Diff(ses, other, opts...)) == 0
+}
+
 func (m *Media) Equals(other *Media) bool {
 	if m == other {
 		return true
@@ -63,7 +75,7 @@ func (m *Media) Equals(other *Media) bool {
 	}
 	if m.Type != other.Type || m.Port != other.Port ||
 		m.PortNum != other.PortNum || m.Proto != other.Proto || m.Information != other.Information ||
-		m.Mode != other.Mode || m.PTime != other.PTime || m.FormatDescr != other.FormatDescr {
+		m.Mode != other.Mode || m.PTime != other.PTime || m.MaxPTime != other.MaxPTime || m.FormatDescr != other.FormatDescr {
 		return false
 	}
 	if !compareConnectionsSlice(m.Connection, other.Connection) {
@@ -2,10 +2,14 @@ package sdp
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,15 +31,54 @@ func ParseString(s string, restoreMissingPTs bool) (*Session, []string, error) {
 	return ses, unknowns, nil
 }
 
+// ParseLenient reads a session description from the string in lenient mode,
+// returning the repairs made as warnings.
+func ParseLenient(s string) (*Session, []*Violation, error) {
+	d := NewDecoderString(s)
+	d.Lenient = true
+	ses, err := d.Decode()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ses, d.Violations(), nil
+}
+
 // A Decoder reads a session description from a stream.
 type Decoder struct {
-	r lineReader
-	p []string
+	// Strict makes Decode check field order, duplicate and missing lines and validate the
+	// result (see Session.Validate), failing with a *ValidationError when any error is found.
+	Strict bool
+	// Lenient makes Decode repair or skip malformed lines instead of failing: trailing whitespace,
+	// an o= line without username, repeated or unknown fields and unparsable lines.
+	// Repairs are reported as warnings by Violations.
+	Lenient bool
+	// Preserve makes the decoded session remember its received lines, so that it is re-encoded byte
+	// for byte when unmodified, and only the changed lines are rewritten otherwise (see Session.DropRaw).
+	Preserve bool
+
+	r     lineReader
+	p     []string
+	opts  DecoderOptions
+	pool  bool // take objects from the pools, see DecodeInto
+	multi bool // descriptions are concatenated, see DecodeNext
+
+	pos, lineStart, start int64 // byte offsets
+	last, lastEOL         string
+	unread                bool
+	sr                    stringReader
+
+	line       int
+	count      limits
+	violations []*Violation
+	mediaLines []int
+	seen       [2]string // fields seen in the session and current media section
+	rank       int
+	section    string
 }
 
 // NewDecoder returns new decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: &reader{b: bufio.NewReaderSize(r, maxLineSize)}}
+	return &Decoder{r: newReader(r, maxLineSize)}
 }
 
 // NewDecoderString returns new decoder that reads from s.
@@ -45,41 +88,214 @@ func NewDecoderString(s string) *Decoder {
 
 // Decode encodes the session description.
 func (d *Decoder) Decode() (*Session, error) {
-	line := 0
-	sess := new(Session)
+	return d.decode(new(Session))
+}
+
+func (d *Decoder) decode(sess *Session) (*Session, error) {
+	d.line, d.count, d.violations, d.mediaLines, d.seen, d.rank, d.section = 0, limits{}, nil, d.mediaLines[:0], [2]string{}, 0, "session"
 	var media *Media
+	var timing bool
+	var sec *rawSection
+	if d.Preserve {
+		sess.raw = new(rawSection)
+		sec = sess.raw
+	}
 
 	for {
-		line++
-		s, err := d.r.ReadLine()
+		d.line++
+		line := d.line
+		s, err := d.readLine()
 		if err != nil {
 			if err == io.EOF && sess.Origin != nil {
 				break
 			}
+			if err == io.EOF && d.multi && d.line > 1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if err == ErrLineTooLong || isLimitError(err) {
+				return nil, newDecodeError(err, line, "")
+			}
 			return nil, err
 		}
+		orig := s
+		if d.Lenient {
+			s = d.repair(s)
+		}
 		if len(s) == 0 && sess.Origin != nil {
 			break
 		}
+		if d.multi {
+			if len(s) == 0 && d.line == 1 {
+				// blank lines between descriptions
+				d.line--
+				continue
+			}
+			if d.line == 1 {
+				d.start = d.lineStart
+			} else if sess.Origin != nil && len(s) > 1 && s[:2] == "v=" {
+				d.unread = true
+				break
+			}
+		}
+		if d.Preserve {
+			if len(s) > 1 && asciiToLowerByte(s[0]) == 'm' && s[1] == '=' {
+				sec = new(rawSection)
+			}
+			d.preserve(sec, orig)
+		}
 		if len(s) < 2 || s[1] != '=' {
-			return nil, &errDecode{errFormat, line, s}
+			if d.Lenient {
+				d.violate(SeverityWarning, "skipped malformed line '%s'", s)
+				continue
+			}
+			return nil, newDecodeError(ErrFormat, line, s)
 		}
 		f, v := asciiToLowerByte(s[0]), s[2:]
+		if err := d.checkLimits(f, v); err != nil {
+			return nil, newDecodeError(err, line, s)
+		}
+		if d.Strict {
+			d.checkOrder(f, len(sess.Media))
+		}
+		if d.Lenient && f == 'o' && sess.Origin == nil {
+			v = d.repairOrigin(v)
+		}
 		if f == 'm' {
-			media = new(Media)
+			if d.Strict || d.Lenient {
+				d.section = fmt.Sprintf("media[%d]", len(sess.Media))
+			}
+			// in lenient mode, the lines of a skipped media section go to the discarded media
+			media = d.newMedia()
+			media.raw = sec
 			err = d.media(media, f, v)
 			if err == nil {
+				d.mediaLines = append(d.mediaLines, line)
 				sess.Media = append(sess.Media, media)
 			}
 		} else if media == nil {
+			timing = timing || f == 't'
 			err = d.session(sess, f, v)
 		} else {
 			err = d.media(media, f, v)
 		}
 		if err != nil {
-			return nil, &errDecode{err, line, s}
+			if d.Lenient {
+				d.violate(SeverityWarning, "skipped line: %v", newDecodeError(err, line, s))
+				continue
+			}
+			return nil, newDecodeError(err, line, s)
 		}
 	}
+	if d.Lenient && !timing {
+		d.violations = append(d.violations, &Violation{Severity: SeverityWarning, Path: "session", Message: "missing t= line, assumed 0 0"})
+	}
+	if d.Preserve {
+		preserved(sess)
+	}
+	if d.Strict {
+		return d.validate(sess)
+	}
+	return sess, nil
+}
+
+// repair removes trailing whitespace and skips blank lines before the origin.
+func (d *Decoder) repair(s string) string {
+	trimmed := strings.TrimRight(s, " \t\r")
+	if len(trimmed) != len(s) && trimmed != "" {
+		d.violate(SeverityWarning, "removed trailing whitespace")
+	}
+	return trimmed
+}
+
+// repairOrigin adds the missing username of an o= line with five fields.
+func (d *Decoder) repairOrigin(v string) string {
+	if p, ok := d.fields(v, 6); !ok && len(p) == 5 {
+		d.violate(SeverityWarning, "o= line with five fields, assumed missing username")
+		return "- " + v
+	}
+	return v
+}
+
+// Violations returns the findings of the last strict or lenient Decode.
+func (d *Decoder) Violations() []*Violation {
+	return d.violations
+}
+
+// RFC 8866 §5 field order of the session and media sections; r= belongs to the preceding t=.
+const (
+	sessionOrder  = "vosiuepcbtrzka"
+	mediaOrder    = "micbka"
+	sessionUnique = "vosiucz"
+	mediaUnique   = "i"
+)
+
+func (d *Decoder) checkOrder(f byte, nmedia int) {
+	order, unique, seen := sessionOrder, sessionUnique, &d.seen[0]
+	if f == 'm' {
+		d.seen[1], d.rank = "", 0
+	}
+	if f == 'm' || nmedia > 0 {
+		order, unique, seen = mediaOrder, mediaUnique, &d.seen[1]
+	}
+	if d.line == 1 && f != 'v' {
+		d.violate(SeverityError, "first line must be v=, got %c=", f)
+	}
+	rank := strings.IndexByte(order, f)
+	if f == 'r' {
+		rank = strings.IndexByte(order, 't')
+	}
+	if rank < 0 {
+		return
+	}
+	if rank < d.rank {
+		d.violate(SeverityWarning, "%c= line out of order", f)
+	}
+	if strings.IndexByte(unique, f) >= 0 && strings.IndexByte(*seen, f) >= 0 {
+		d.violate(SeverityError, "duplicate %c= line", f)
+	}
+	*seen += string(f)
+	d.rank = max(d.rank, rank)
+}
+
+func (d *Decoder) violate(sev Severity, format string, args ...any) {
+	d.violations = append(d.violations, &Violation{Severity: sev, Line: d.line, Path: d.section, Message: fmt.Sprintf(format, args...)})
+}
+
+// direction sets the direction attribute of a section, reporting conflicts in strict mode.
+func (d *Decoder) direction(mode *string, name string) {
+	if d.Strict && *mode != "" {
+		if *mode != name {
+			d.violate(SeverityError, "conflicting direction attributes %s and %s", *mode, name)
+		} else {
+			d.violate(SeverityWarning, "duplicate direction attribute %s", name)
+		}
+	}
+	*mode = name
+}
+
+func (d *Decoder) validate(sess *Session) (*Session, error) {
+	for _, f := range "vst" {
+		if !strings.ContainsRune(d.seen[0], f) {
+			d.violations = append(d.violations, &Violation{Severity: SeverityError, Path: "session", Message: fmt.Sprintf("missing %c= line", f)})
+		}
+	}
+	v := &validator{mediaLines: d.mediaLines}
+	v.session(sess)
+	d.violations = append(d.violations, v.violations...)
+	slices.SortStableFunc(d.violations, func(a, b *Violation) int {
+		switch {
+		case a.Line == b.Line:
+			return 0
+		case a.Line == 0:
+			return 1
+		case b.Line == 0:
+			return -1
+		}
+		return a.Line - b.Line
+	})
+	if HasErrors(d.violations) {
+		return nil, &ValidationError{Violations: d.violations}
+	}
 	return sess, nil
 }
 
@@ -90,7 +306,7 @@ func (d *Decoder) session(s *Session, f byte, v string) error {
 		s.Version, err = strconv.Atoi(v)
 	case 'o':
 		if s.Origin != nil {
-			return errUnexpectedField
+			return ErrUnexpectedField
 		}
 		s.Origin, err = d.origin(v)
 	case 's':
@@ -105,7 +321,7 @@ func (d *Decoder) session(s *Session, f byte, v string) error {
 		s.Phone = append(s.Phone, v)
 	case 'c':
 		if s.Connection != nil {
-			return errUnexpectedField
+			return ErrUnexpectedField
 		}
 		s.Connection, err = d.connection(v)
 	case 'b':
@@ -122,11 +338,13 @@ func (d *Decoder) session(s *Session, f byte, v string) error {
 		a := d.attr(v)
 		switch a.Name {
 		case PTime:
-			s.PTime = a.Value
+			d.packetTime(&s.PTime, &s.Attributes, a)
+		case MaxPTime:
+			d.packetTime(&s.MaxPTime, &s.Attributes, a)
 		case Inactive, RecvOnly, SendOnly, SendRecv:
-			s.Mode = a.Name
+			d.direction(&s.Mode, a.Name)
 		default:
-			s.Attributes = append(s.Attributes, a)
+			s.Attributes = append(s.Attributes, d.newAttr(a.Name, a.Value))
 		}
 	case 't':
 		s.Timing, err = d.timing(v)
@@ -137,7 +355,7 @@ func (d *Decoder) session(s *Session, f byte, v string) error {
 		}
 		s.Repeat = append(s.Repeat, r)
 	default:
-		return errUnexpectedField
+		return ErrUnexpectedField
 	}
 	return err
 }
@@ -167,24 +385,26 @@ func (d *Decoder) media(m *Media, f byte, v string) error {
 		a := d.attr(v)
 		switch a.Name {
 		case PTime:
-			m.PTime = a.Value
+			d.packetTime(&m.PTime, &m.Attributes, a)
+		case MaxPTime:
+			d.packetTime(&m.MaxPTime, &m.Attributes, a)
 		case Inactive, RecvOnly, SendOnly, SendRecv:
-			m.Mode = a.Name
+			d.direction(&m.Mode, a.Name)
 		case "rtpmap", "rtcp-fb", "fmtp":
 			err = d.format(m, a)
 		default:
-			m.Attributes = append(m.Attributes, a)
+			m.Attributes = append(m.Attributes, d.newAttr(a.Name, a.Value))
 		}
 	default:
-		return errUnexpectedField
+		return ErrUnexpectedField
 	}
 	return err
 }
 
-func (d *Decoder) format(m *Media, a *Attr) error {
+func (d *Decoder) format(m *Media, a Attr) error {
 	p, ok := d.fields(a.Value, 2)
 	if !ok {
-		return errFormat
+		return ErrFormat
 	}
 	var (
 		pt     = p[0]
@@ -194,13 +414,13 @@ func (d *Decoder) format(m *Media, a *Attr) error {
 	if pt == "*" {
 		format = m.Formats
 	} else {
-		pt, err := strconv.Atoi(pt)
-		if err != nil {
+		pt, err := d.payload(pt)
+		if err != nil || pt < 0 {
 			return err
 		}
 		f := m.FormatByPayload(uint8(pt))
 		if f == nil {
-			f = &Format{Payload: uint8(pt)}
+			f = d.newFormat(uint8(pt))
 			m.Formats = append(m.Formats, f)
 		}
 		format = append(format, f)
@@ -224,7 +444,7 @@ func (d *Decoder) format(m *Media, a *Attr) error {
 func (d *Decoder) rtpmap(f *Format, v string) error {
 	p, ok := d.split(v, '/', 3)
 	if len(p) < 2 {
-		return errFormat
+		return ErrFormat
 	}
 	f.Name = p[0]
 	f.Channels = 1
@@ -243,7 +463,7 @@ func (d *Decoder) rtpmap(f *Format, v string) error {
 func (d *Decoder) proto(m *Media, v string) error {
 	p, ok := d.fields(v, 4)
 	if !ok {
-		return errFormat
+		return ErrFormat
 	}
 	formats := p[3]
 	m.Type, m.Proto = asciiToLower(p[0]), p[2]
@@ -263,21 +483,41 @@ func (d *Decoder) proto(m *Media, v string) error {
 	}
 	p, _ = d.fields(formats, maxLineSize)
 	for _, it := range p {
-		pt, err := strconv.Atoi(it)
+		pt, err := d.payload(it)
 		if err != nil {
 			return err
 		}
-		m.Formats = append(m.Formats, &Format{Payload: uint8(pt)})
+		if pt < 0 {
+			continue
+		}
+		m.Formats = append(m.Formats, d.newFormat(uint8(pt)))
 	}
 	return nil
 }
 
+// payload parses a payload type. Values that do not fit in a byte are an error or, in strict mode,
+// a violation reported with a negative payload type; values above 127 are reported by the validator.
+func (d *Decoder) payload(v string) (int, error) {
+	pt, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if pt < 0 || pt > 255 {
+		if !d.Strict {
+			return 0, ErrFormat
+		}
+		d.violate(SeverityError, "payload type %d out of range 0-255", pt)
+		return -1, nil
+	}
+	return pt, nil
+}
+
 func (d *Decoder) origin(v string) (*Origin, error) {
 	p, ok := d.fields(v, 6)
 	if !ok {
-		return nil, errFormat
+		return nil, ErrFormat
 	}
-	o := new(Origin)
+	o := d.newOrigin()
 	o.Username, o.Network, o.Type, o.Address = p[0], p[3], p[4], p[5]
 	var err error
 	if o.SessionID, err = d.int(p[1]); err != nil {
@@ -292,9 +532,9 @@ func (d *Decoder) origin(v string) (*Origin, error) {
 func (d *Decoder) connection(v string) (*Connection, error) {
 	p, ok := d.fields(v, 3)
 	if !ok {
-		return nil, errFormat
+		return nil, ErrFormat
 	}
-	c := new(Connection)
+	c := d.newConnection()
 	c.Network, c.Type, c.Address = p[0], p[1], p[2]
 	p, _ = d.split(c.Address, '/', 3)
 	switch c.Type {
@@ -329,7 +569,7 @@ func (d *Decoder) connection(v string) (*Connection, error) {
 func (d *Decoder) bandwidth(v string) (*Bandwidth, error) {
 	p, ok := d.split(v, ':', 2)
 	if !ok {
-		return nil, errFormat
+		return nil, ErrFormat
 	}
 	val, err := d.int(p[1])
 	if err != nil {
@@ -366,17 +606,17 @@ func (d *Decoder) key(v string) *Key {
 	return &Key{v, ""}
 }
 
-func (d *Decoder) attr(v string) *Attr {
+func (d *Decoder) attr(v string) Attr {
 	if p, ok := d.split(v, ':', 2); ok {
-		return &Attr{asciiToLower(p[0]), p[1]}
+		return Attr{asciiToLower(p[0]), p[1]}
 	}
-	return &Attr{v, ""}
+	return Attr{v, ""}
 }
 
 func (d *Decoder) timing(v string) (*Timing, error) {
 	p, ok := d.fields(v, 2)
 	if !ok {
-		return nil, errFormat
+		return nil, ErrFormat
 	}
 	start, err := d.time(p[0])
 	if err != nil {
@@ -395,7 +635,7 @@ func (d *Decoder) timing(v string) (*Timing, error) {
 func (d *Decoder) repeat(v string) (*Repeat, error) {
 	p, _ := d.fields(v, maxLineSize)
 	if len(p) < 2 {
-		return nil, errFormat
+		return nil, ErrFormat
 	}
 	r := new(Repeat)
 	var err error
@@ -444,6 +684,35 @@ func (d *Decoder) duration(v string) (time.Duration, error) {
 	return time.Duration(sec*m) * time.Second, nil
 }
 
+// packetTime sets a ptime or maxptime value. A value that is not a valid duration is kept
+// as a plain attribute and, in strict and lenient mode, reported as a warning.
+func (d *Decoder) packetTime(dst *time.Duration, attrs *Attributes, a Attr) {
+	v, err := d.ptime(a.Value)
+	if err != nil {
+		if d.Strict || d.Lenient {
+			d.violate(SeverityWarning, "invalid %s value '%s'", a.Name, a.Value)
+		}
+		*attrs = append(*attrs, d.newAttr(a.Name, a.Value))
+		return
+	}
+	*dst = v
+}
+
+// maxPTime is the largest packet time in milliseconds that fits in a time.Duration.
+const maxPTime = float64(math.MaxInt64 / int64(time.Millisecond))
+
+// ptime parses a packet time in milliseconds, possibly fractional (e.g. "2.5").
+func (d *Decoder) ptime(v string) (time.Duration, error) {
+	ms, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(ms) || ms < 0 || ms > maxPTime {
+		return 0, ErrFormat
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
 func (d *Decoder) int(v string) (int64, error) {
 	return strconv.ParseInt(v, 10, 64)
 }
@@ -473,10 +742,17 @@ const maxLineSize = 1024
 
 type lineReader interface {
 	ReadLine() (string, error)
+	EOL() string // line ending of the last line read
 }
 
 type stringReader struct {
-	s string
+	s   string
+	max int
+	eol string
+}
+
+func (r *stringReader) EOL() string {
+	return r.eol
 }
 
 func (r *stringReader) ReadLine() (string, error) {
@@ -487,41 +763,125 @@ func (r *stringReader) ReadLine() (string, error) {
 	for i, ch := range s {
 		if ch == '\n' {
 			r.s = s[i+1:]
+			end := i + 1
 			for i > 0 && s[i-1] == '\r' {
 				i--
 			}
+			r.eol = s[i:end]
+			if r.max > 0 && i > r.max {
+				return "", ErrLineTooLong
+			}
 			return s[:i], nil
 		}
 	}
-	r.s = ""
+	r.s, r.eol = "", ""
+	if r.max > 0 && n > r.max {
+		return "", ErrLineTooLong
+	}
 	return s, nil
 }
 
 type reader struct {
-	b *bufio.Reader
+	b   *bufio.Reader
+	eol string
+}
+
+func (r *reader) EOL() string {
+	return r.eol
+}
+
+func newReader(r io.Reader, size int) *reader {
+	return &reader{b: bufio.NewReaderSize(r, size)}
 }
 
 func (r *reader) ReadLine() (string, error) {
-	b, prefix, err := r.b.ReadLine()
-	if prefix && err == nil {
-		err = errLineTooLong
-	}
-	if err != nil {
+	b, err := r.b.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		return "", ErrLineTooLong
+	case err == io.EOF && len(b) > 0:
+		// last line without line ending
+	case err != nil:
+		// including a line cut short by a limit
 		return "", err
 	}
-	return string(b), nil
+	line := bytes.TrimSuffix(b, []byte{'\n'})
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	switch eol := b[len(line):]; string(eol) {
+	case "\r\n":
+		r.eol = "\r\n"
+	case "\n":
+		r.eol = "\n"
+	default:
+		r.eol = string(eol)
+	}
+	return string(line), nil
+}
+
+// Decode errors, matched with errors.Is against a *DecodeError.
+var (
+	ErrLineTooLong     = errors.New("line is too long")
+	ErrUnexpectedField = errors.New("unexpected field")
+	ErrFormat          = errors.New("format error")
+)
+
+// DecodeErrorKind classifies decode errors, e.g. for metrics.
+type DecodeErrorKind int
+
+const (
+	DecodeErrorFormat          DecodeErrorKind = iota // malformed line or wrong number of fields
+	DecodeErrorUnexpectedField                        // unknown, misplaced or repeated field
+	DecodeErrorInvalidValue                           // unparsable number
+	DecodeErrorLineTooLong
+	DecodeErrorLimit // a DecoderOptions limit was exceeded, see LimitError
+)
+
+var decodeErrorKindNames = []string{"format", "unexpected-field", "invalid-value", "line-too-long", "limit"}
+
+func (k DecodeErrorKind) String() string {
+	if int(k) < len(decodeErrorKindNames) {
+		return decodeErrorKindNames[k]
+	}
+	return "unknown"
+}
+
+// DecodeError is returned by Decode for a line that cannot be parsed.
+type DecodeError struct {
+	Line  int    // 1-based line number
+	Field byte   // field letter, e.g. 'm', 0 if the line is malformed
+	Text  string // raw line
+	Kind  DecodeErrorKind
+	Err   error
 }
 
-var errLineTooLong = errors.New("sdp: line is too long")
-var errUnexpectedField = errors.New("unexpected field")
-var errFormat = errors.New("format error")
+func newDecodeError(err error, line int, text string) *DecodeError {
+	e := &DecodeError{Line: line, Text: text, Err: err}
+	if len(text) > 1 && text[1] == '=' {
+		e.Field = asciiToLowerByte(text[0])
+	}
+	var numErr *strconv.NumError
+	switch {
+	case errors.Is(err, ErrLineTooLong):
+		e.Kind = DecodeErrorLineTooLong
+	case isLimitError(err):
+		e.Kind = DecodeErrorLimit
+	case errors.Is(err, ErrUnexpectedField):
+		e.Kind = DecodeErrorUnexpectedField
+	case errors.As(err, &numErr):
+		e.Kind = DecodeErrorInvalidValue
+	}
+	return e
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("sdp: %s on line %d '%s'", e.Err.Error(), e.Line, e.Text)
+}
 
-type errDecode struct {
-	err  error
-	line int
-	text string
+func isLimitError(err error) bool {
+	var limitErr *LimitError
+	return errors.As(err, &limitErr)
 }
 
-func (e *errDecode) Error() string {
-	return fmt.Sprintf("sdp: %s on line %d '%s'", e.err.Error(), e.line, e.text)
+func (e *DecodeError) Unwrap() error {
+	return e.Err
 }
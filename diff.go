@@ -0,0 +1,467 @@
+package sdp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeKind is the kind of a structural change between two session descriptions.
+type ChangeKind string
+
+const (
+	DiffAdded     ChangeKind = "added"
+	DiffRemoved   ChangeKind = "removed"
+	DiffModified  ChangeKind = "modified"
+	DiffReordered ChangeKind = "reordered"
+)
+
+// Change is one structural difference, e.g. path "media[1].formats[pt=8]" or
+// "session.attributes[ice-ufrag]". Old is empty for additions and New for removals.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  string
+	New  string
+}
+
+func (c *Change) String() string {
+	var b strings.Builder
+	if c.Kind != DiffAdded {
+		b.WriteString("- " + c.Path + ": " + c.Old)
+	}
+	if c.Kind != DiffRemoved {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("+ " + c.Path + ": " + c.New)
+	}
+	return b.String()
+}
+
+// CompareOption configures Diff and EqualsWith.
+type CompareOption func(*compareOptions)
+
+type compareOptions struct {
+	ignoreOriginVersion  bool
+	ignoreAttrOrder      bool
+	ignoreCandidateOrder bool
+	ignoreAttrCase       bool
+	ignorePorts          bool
+	ignoreConnections    bool
+	ignoreFormatOrder    bool
+	ignoreFmtpOrder      bool
+	ignoreAttrs          map[string]struct{}
+}
+
+// IgnoreOriginVersion ignores the origin session version.
+func IgnoreOriginVersion() CompareOption {
+	return func(o *compareOptions) { o.ignoreOriginVersion = true }
+}
+
+// IgnoreAttributeOrder ignores the order of attribute lines, including repeated ones.
+func IgnoreAttributeOrder() CompareOption {
+	return func(o *compareOptions) { o.ignoreAttrOrder = true }
+}
+
+// IgnoreCandidateOrder ignores the order of ICE candidate lines only.
+func IgnoreCandidateOrder() CompareOption {
+	return func(o *compareOptions) { o.ignoreCandidateOrder = true }
+}
+
+// IgnoreAttributeCase compares attribute names case-insensitively.
+func IgnoreAttributeCase() CompareOption {
+	return func(o *compareOptions) { o.ignoreAttrCase = true }
+}
+
+// IgnorePorts ignores media ports and port counts.
+func IgnorePorts() CompareOption {
+	return func(o *compareOptions) { o.ignorePorts = true }
+}
+
+// IgnoreConnections ignores session and media connection lines.
+func IgnoreConnections() CompareOption {
+	return func(o *compareOptions) { o.ignoreConnections = true }
+}
+
+// IgnoreFormatOrder ignores the order of formats in media lines.
+func IgnoreFormatOrder() CompareOption {
+	return func(o *compareOptions) { o.ignoreFormatOrder = true }
+}
+
+// IgnoreFmtpOrder ignores the order of the parameters of fmtp lines, e.g. "a=1;b=2" equals "b=2; a=1".
+func IgnoreFmtpOrder() CompareOption {
+	return func(o *compareOptions) { o.ignoreFmtpOrder = true }
+}
+
+// IgnoreAttributes ignores attributes with the given names (case-insensitive), e.g. candidate or ssrc.
+func IgnoreAttributes(names ...string) CompareOption {
+	return func(o *compareOptions) {
+		if o.ignoreAttrs == nil {
+			o.ignoreAttrs = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			o.ignoreAttrs[asciiToLower(name)] = struct{}{}
+		}
+	}
+}
+
+func newCompareOptions(opts []CompareOption) *compareOptions {
+	o := new(compareOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Diff returns the structural changes from a to b. Unlike Equals it does not stop at the first difference.
+// A nil session is reported as a whole session added or removed.
+func Diff(a, b *Session, opts ...CompareOption) []*Change {
+	d := &differ{o: newCompareOptions(opts)}
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.add("session", DiffAdded, "", sessionString(b))
+	case b == nil:
+		d.add("session", DiffRemoved, sessionString(a), "")
+	default:
+		d.session(a, b)
+	}
+	return d.changes
+}
+
+// RenderDiff renders changes as unified text, one "-" line per old and one "+" line per new value.
+func RenderDiff(changes []*Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+type differ struct {
+	o       *compareOptions
+	changes []*Change
+}
+
+func (d *differ) add(path string, kind ChangeKind, old, new string) {
+	d.changes = append(d.changes, &Change{Path: path, Kind: kind, Old: old, New: new})
+}
+
+// value compares two values of a single field.
+func (d *differ) value(path, old, new string) {
+	switch {
+	case old == new:
+	case old == "":
+		d.add(path, DiffAdded, old, new)
+	case new == "":
+		d.add(path, DiffRemoved, old, new)
+	default:
+		d.add(path, DiffModified, old, new)
+	}
+}
+
+// list compares repeated values by position.
+func (d *differ) list(path string, old, new []string) {
+	for i := range max(len(old), len(new)) {
+		var a, b string
+		if i < len(old) {
+			a = old[i]
+		}
+		if i < len(new) {
+			b = new[i]
+		}
+		d.value(fmt.Sprintf("%s[%d]", path, i), a, b)
+	}
+}
+
+// keyed compares values identified by a key, such as bandwidth modifiers.
+func (d *differ) keyed(path string, oldKeys, old, newKeys, new []string) {
+	for i, k := range oldKeys {
+		j := slices.Index(newKeys, k)
+		if j < 0 {
+			d.add(path+"["+k+"]", DiffRemoved, old[i], "")
+			continue
+		}
+		d.value(path+"["+k+"]", old[i], new[j])
+	}
+	for j, k := range newKeys {
+		if !slices.Contains(oldKeys, k) {
+			d.add(path+"["+k+"]", DiffAdded, "", new[j])
+		}
+	}
+}
+
+func (d *differ) session(a, b *Session) {
+	const p = "session"
+	d.value(p+".version", strconv.Itoa(a.Version), strconv.Itoa(b.Version))
+	d.origin(p+".origin", a.Origin, b.Origin)
+	d.value(p+".name", a.Name, b.Name)
+	d.value(p+".information", a.Information, b.Information)
+	d.value(p+".uri", a.URI, b.URI)
+	d.list(p+".email", a.Email, b.Email)
+	d.list(p+".phone", a.Phone, b.Phone)
+	if !d.o.ignoreConnections {
+		d.value(p+".connection", connectionString(a.Connection), connectionString(b.Connection))
+	}
+	d.bandwidths(p+".bandwidth", a.Bandwidth, b.Bandwidth)
+	d.value(p+".timing", timingString(a.Timing), timingString(b.Timing))
+	d.list(p+".repeat", mapStrings(a.Repeat, repeatString), mapStrings(b.Repeat, repeatString))
+	d.value(p+".timezone", timezoneString(a.TimeZone), timezoneString(b.TimeZone))
+	d.list(p+".key", mapStrings(a.Key, keyString), mapStrings(b.Key, keyString))
+	d.value(p+".mode", a.Mode, b.Mode)
+	d.value(p+".ptime", durationString(a.PTime), durationString(b.PTime))
+	d.value(p+".maxptime", durationString(a.MaxPTime), durationString(b.MaxPTime))
+	d.attributes(p+".attributes", a.Attributes, b.Attributes)
+
+	for i := range max(len(a.Media), len(b.Media)) {
+		path := fmt.Sprintf("media[%d]", i)
+		switch {
+		case i >= len(a.Media):
+			d.add(path, DiffAdded, "", mediaString(b.Media[i]))
+		case i >= len(b.Media):
+			d.add(path, DiffRemoved, mediaString(a.Media[i]), "")
+		default:
+			d.media(path, a.Media[i], b.Media[i])
+		}
+	}
+}
+
+func (d *differ) origin(path string, a, b *Origin) {
+	if a == nil || b == nil {
+		d.value(path, originString(a), originString(b))
+		return
+	}
+	d.value(path+".username", a.Username, b.Username)
+	d.value(path+".sessionId", strconv.FormatInt(a.SessionID, 10), strconv.FormatInt(b.SessionID, 10))
+	if !d.o.ignoreOriginVersion {
+		d.value(path+".sessionVersion", strconv.FormatInt(a.SessionVersion, 10), strconv.FormatInt(b.SessionVersion, 10))
+	}
+	d.value(path+".address", strings.Join([]string{a.Network, a.Type, a.Address}, " "), strings.Join([]string{b.Network, b.Type, b.Address}, " "))
+}
+
+func (d *differ) media(path string, a, b *Media) {
+	d.value(path+".type", a.Type, b.Type)
+	if !d.o.ignorePorts {
+		d.value(path+".port", strconv.Itoa(a.Port), strconv.Itoa(b.Port))
+		d.value(path+".portNum", strconv.Itoa(a.PortNum), strconv.Itoa(b.PortNum))
+	}
+	d.value(path+".proto", a.Proto, b.Proto)
+	d.value(path+".information", a.Information, b.Information)
+	if !d.o.ignoreConnections {
+		d.list(path+".connection", mapStrings(a.Connection, connectionString), mapStrings(b.Connection, connectionString))
+	}
+	d.bandwidths(path+".bandwidth", a.Bandwidth, b.Bandwidth)
+	d.list(path+".key", mapStrings(a.Key, keyString), mapStrings(b.Key, keyString))
+	d.value(path+".mode", a.Mode, b.Mode)
+	d.value(path+".ptime", durationString(a.PTime), durationString(b.PTime))
+	d.value(path+".maxptime", durationString(a.MaxPTime), durationString(b.MaxPTime))
+	d.value(path+".formatDescr", a.FormatDescr, b.FormatDescr)
+	d.formats(path+".formats", a.Formats, b.Formats)
+	d.attributes(path+".attributes", a.Attributes, b.Attributes)
+}
+
+func (d *differ) bandwidths(path string, a, b []*Bandwidth) {
+	key := func(bw *Bandwidth) string { return bw.Type }
+	val := func(bw *Bandwidth) string { return strconv.Itoa(bw.Value) }
+	d.keyed(path, mapStrings(a, key), mapStrings(a, val), mapStrings(b, key), mapStrings(b, val))
+}
+
+func (d *differ) formats(path string, a, b []*Format) {
+	key := func(f *Format) string { return "pt=" + strconv.Itoa(int(f.Payload)) }
+	val := func(f *Format) string { return formatString(f, d.o.ignoreFmtpOrder) }
+	d.keyed(path, mapStrings(a, key), mapStrings(a, val), mapStrings(b, key), mapStrings(b, val))
+	if d.o.ignoreFormatOrder {
+		return
+	}
+
+	pa, pb := payloadList(a), payloadList(b)
+	if common := commonOrder(pa, pb); !slices.Equal(common, commonOrder(pb, pa)) {
+		d.add(path, DiffReordered, strings.Join(pa, " "), strings.Join(pb, " "))
+	}
+}
+
+func (d *differ) attributes(path string, a, b Attributes) {
+	ka, va := d.groupAttributes(a)
+	kb, vb := d.groupAttributes(b)
+
+	for _, k := range ka {
+		d.attributeValues(path+"["+k+"]", va[k], vb[k])
+	}
+	for _, k := range kb {
+		if _, ok := va[k]; !ok {
+			d.attributeValues(path+"["+k+"]", nil, vb[k])
+		}
+	}
+
+	if !d.o.ignoreAttrOrder {
+		if oa, ob := commonOrder(ka, kb), commonOrder(kb, ka); !slices.Equal(oa, ob) {
+			d.add(path, DiffReordered, strings.Join(ka, " "), strings.Join(kb, " "))
+		}
+	}
+}
+
+func (d *differ) attributeValues(path string, a, b []string) {
+	removed, added := multisetDiff(a, b), multisetDiff(b, a)
+	switch {
+	case len(removed) == 1 && len(added) == 1:
+		d.add(path, DiffModified, removed[0], added[0])
+		return
+	case len(removed) > 0 || len(added) > 0:
+		for _, v := range removed {
+			d.add(path, DiffRemoved, v, "")
+		}
+		for _, v := range added {
+			d.add(path, DiffAdded, "", v)
+		}
+		return
+	}
+	ignoreOrder := d.o.ignoreAttrOrder || d.o.ignoreCandidateOrder && strings.EqualFold(path[strings.LastIndexByte(path, '[')+1:len(path)-1], "candidate")
+	if !ignoreOrder && !slices.Equal(a, b) {
+		d.add(path, DiffReordered, strings.Join(a, "\n"), strings.Join(b, "\n"))
+	}
+}
+
+// groupAttributes returns attribute names in order of first appearance and their values.
+func (d *differ) groupAttributes(attrs Attributes) ([]string, map[string][]string) {
+	var keys []string
+	values := make(map[string][]string, len(attrs))
+	for _, a := range attrs {
+		k := a.Name
+		if d.o.ignoreAttrCase {
+			k = asciiToLower(k)
+		}
+		if _, ok := d.o.ignoreAttrs[asciiToLower(k)]; ok {
+			continue
+		}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = append(values[k], a.Value)
+	}
+	return keys, values
+}
+
+// multisetDiff returns the values of a not found in b, counting duplicates.
+func multisetDiff(a, b []string) []string {
+	count := make(map[string]int, len(b))
+	for _, v := range b {
+		count[v]++
+	}
+	var diff []string
+	for _, v := range a {
+		if count[v] > 0 {
+			count[v]--
+			continue
+		}
+		diff = append(diff, v)
+	}
+	return diff
+}
+
+// commonOrder returns the items of a also present in b, in the order of a.
+func commonOrder(a, b []string) []string {
+	common := make([]string, 0, len(a))
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			common = append(common, v)
+		}
+	}
+	return common
+}
+
+func mapStrings[T any](items []T, fn func(T) string) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = fn(it)
+	}
+	return out
+}
+
+func payloadList(formats []*Format) []string {
+	return mapStrings(formats, func(f *Format) string { return strconv.Itoa(int(f.Payload)) })
+}
+
+// sessionString summarizes a session by its origin.
+func sessionString(s *Session) string {
+	if s.Origin == nil {
+		return "v=" + strconv.Itoa(s.Version)
+	}
+	return originString(s.Origin)
+}
+
+func originString(o *Origin) string {
+	if o == nil {
+		return ""
+	}
+	return string(writer(nil).origin(o))
+}
+
+func connectionString(c *Connection) string {
+	if c == nil {
+		return ""
+	}
+	return string(writer(nil).connection(c))
+}
+
+func timingString(t *Timing) string {
+	return string(writer(nil).timing(t))
+}
+
+func repeatString(r *Repeat) string {
+	return string(writer(nil).repeat(r))
+}
+
+func timezoneString(z []*TimeZone) string {
+	return string(writer(nil).timezone(z))
+}
+
+func keyString(k *Key) string {
+	return string(writer(nil).key(k))
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return string(writer(nil).ptime(d))
+}
+
+func mediaString(m *Media) string {
+	b := writer(nil).media(&Media{Type: m.Type, Port: m.Port, PortNum: m.PortNum, Proto: m.Proto, FormatDescr: m.FormatDescr, Formats: m.Formats})
+	s, _ := strings.CutPrefix(string(b), "\r\nm=")
+	return strings.SplitN(s, "\r\n", 2)[0]
+}
+
+func formatString(f *Format, sortFmtp bool) string {
+	var b strings.Builder
+	if f.Name != "" {
+		b.WriteString(f.Name + "/" + strconv.Itoa(f.ClockRate))
+		if f.Channels > 1 {
+			b.WriteString("/" + strconv.Itoa(f.Channels))
+		}
+	}
+	for _, p := range f.Params {
+		if sortFmtp {
+			p = sortedFmtp(p)
+		}
+		b.WriteString(" fmtp:" + p)
+	}
+	for _, fb := range f.Feedback {
+		b.WriteString(" rtcp-fb:" + fb)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// sortedFmtp returns the fmtp parameters sorted, without surrounding spaces.
+func sortedFmtp(params string) string {
+	parts := strings.Split(params, ";")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ";")
+}
@@ -8,8 +8,9 @@ import (
 
 // An Encoder writes a session description to a buffer.
 type Encoder struct {
-	w io.Writer
-	b writer
+	w    io.Writer
+	b    writer
+	opts EncoderOptions
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -25,7 +26,10 @@ func NewEncoderSize(w io.Writer, size int) *Encoder {
 // Encode encodes the session description.
 func (e *Encoder) Encode(s *Session) error {
 	e.Reset()
-	e.b = e.b.session(s)
+	var err error
+	if e.b, err = e.opts.append(e.b, s); err != nil {
+		return err
+	}
 	if e.w != nil {
 		return e.Flush()
 	}
@@ -89,6 +93,17 @@ func (w writer) crlf() writer {
 }
 
 func (w writer) session(s *Session) writer {
+	if s.raw != nil {
+		return w.sessionPreserved(s)
+	}
+	w = w.sessionHeader(s)
+	for _, it := range s.Media {
+		w = w.media(it)
+	}
+	return w.crlf()
+}
+
+func (w writer) sessionHeader(s *Session) writer {
 	w = w.str("v=").int(int64(s.Version))
 	if s.Origin != nil {
 		w = w.add('o').origin(s.Origin)
@@ -125,16 +140,16 @@ func (w writer) session(s *Session) writer {
 	if s.Mode != "" {
 		w = w.add('a').str(s.Mode)
 	}
-	if s.PTime != "" {
-		w = w.add('a').str(s.PTime)
+	if s.PTime > 0 {
+		w = w.add('a').str("ptime:").ptime(s.PTime)
+	}
+	if s.MaxPTime > 0 {
+		w = w.add('a').str("maxptime:").ptime(s.MaxPTime)
 	}
 	for _, it := range s.Attributes {
 		w = w.add('a').attr(it)
 	}
-	for _, it := range s.Media {
-		w = w.media(it)
-	}
-	return w.crlf()
+	return w
 }
 
 func (w writer) origin(o *Origin) writer {
@@ -142,6 +157,27 @@ func (w writer) origin(o *Origin) writer {
 }
 
 func (w writer) media(m *Media) writer {
+	w = w.mediaHeader(m)
+	for _, it := range m.Formats {
+		w = w.format(it)
+	}
+	if m.Mode != "" {
+		w = w.add('a').str(m.Mode)
+	}
+	if m.PTime > 0 {
+		w = w.add('a').str("ptime:").ptime(m.PTime)
+	}
+	if m.MaxPTime > 0 {
+		w = w.add('a').str("maxptime:").ptime(m.MaxPTime)
+	}
+	for _, it := range m.Attributes {
+		w = w.add('a').attr(it)
+	}
+	return w
+}
+
+// mediaHeader writes the m= line and the i=, c=, b= and k= lines of the media.
+func (w writer) mediaHeader(m *Media) writer {
 	w = w.add('m').str(m.Type).sp().int(int64(m.Port))
 	if m.PortNum > 0 {
 		w = w.char('/').int(int64(m.PortNum))
@@ -166,18 +202,6 @@ func (w writer) media(m *Media) writer {
 	for _, it := range m.Key {
 		w = w.add('k').key(it)
 	}
-	for _, it := range m.Formats {
-		w = w.format(it)
-	}
-	if m.Mode != "" {
-		w = w.add('a').str(m.Mode)
-	}
-	if m.PTime != "" {
-		w = w.add('a').str("ptime:" + m.PTime)
-	}
-	for _, it := range m.Attributes {
-		w = w.add('a').attr(it)
-	}
 	return w
 }
 
@@ -253,6 +277,13 @@ func (w writer) duration(d time.Duration) writer {
 	}
 }
 
+func (w writer) ptime(d time.Duration) writer {
+	if d%time.Millisecond == 0 {
+		return w.int(int64(d / time.Millisecond))
+	}
+	return strconv.AppendFloat(w, float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
+
 func (w writer) bandwidth(b *Bandwidth) writer {
 	return w.str(b.Type).char(':').int(int64(b.Value))
 }
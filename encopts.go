@@ -0,0 +1,167 @@
+package sdp
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// EncoderOptions configures an Encoder.
+type EncoderOptions struct {
+	// LF ends lines with "\n" instead of "\r\n".
+	LF bool
+	// Canonical ignores the received line order of sessions decoded with Decoder.Preserve, writes
+	// rtpmap, fmtp and rtcp-fb lines of each format together, followed by ptime, maxptime and
+	// the direction, and sorts the other attributes by name, keeping the order of repeated ones.
+	Canonical bool
+	// Strict fails on empty required fields instead of writing "-", IN, IP4 or 127.0.0.1.
+	Strict bool
+}
+
+// NewEncoderOptions returns a new encoder that writes to w with the given options.
+func NewEncoderOptions(w io.Writer, opts EncoderOptions) *Encoder {
+	e := NewEncoder(w)
+	e.opts = opts
+	return e
+}
+
+// AppendTo appends the encoded session description to dst, using the encoder options
+// but not its buffer.
+func (e *Encoder) AppendTo(dst []byte, s *Session) ([]byte, error) {
+	return e.opts.append(dst, s)
+}
+
+// AppendTo appends the encoded session description to dst.
+func (ses *Session) AppendTo(dst []byte) []byte {
+	return writer(dst).session(ses)
+}
+
+func (o *EncoderOptions) append(dst writer, s *Session) (writer, error) {
+	if o.Strict {
+		if err := checkEncodable(s); err != nil {
+			return dst, err
+		}
+	}
+	start := len(dst)
+	if o.Canonical {
+		dst = dst.canonical(s)
+	} else {
+		dst = dst.session(s)
+	}
+	if o.LF {
+		dst = toLF(dst, start)
+	}
+	return dst, nil
+}
+
+// toLF replaces the CRLF line endings written after start in place.
+func toLF(w writer, start int) writer {
+	n := start
+	for i := start; i < len(w); i++ {
+		if w[i] == '\r' && i+1 < len(w) && w[i+1] == '\n' {
+			continue
+		}
+		w[n] = w[i]
+		n++
+	}
+	return w[:n]
+}
+
+func (w writer) canonical(s *Session) writer {
+	header := *s
+	header.raw, header.Media = nil, nil
+	header.Attributes = sortedAttrs(s.Attributes)
+	w = w.sessionHeader(&header)
+	for _, m := range s.Media {
+		w = w.mediaHeader(m)
+		for _, f := range m.Formats {
+			w = w.canonicalFormat(f)
+		}
+		if m.PTime > 0 {
+			w = w.add('a').str("ptime:").ptime(m.PTime)
+		}
+		if m.MaxPTime > 0 {
+			w = w.add('a').str("maxptime:").ptime(m.MaxPTime)
+		}
+		if m.Mode != "" {
+			w = w.add('a').str(m.Mode)
+		}
+		for _, it := range sortedAttrs(m.Attributes) {
+			w = w.add('a').attr(it)
+		}
+	}
+	return w.crlf()
+}
+
+func (w writer) canonicalFormat(f *Format) writer {
+	w = w.format(&Format{Payload: f.Payload, Name: f.Name, ClockRate: f.ClockRate, Channels: f.Channels, Params: f.Params})
+	for _, it := range f.Feedback {
+		w = w.add('a').str("rtcp-fb:").int(int64(f.Payload)).sp().str(it)
+	}
+	return w
+}
+
+func sortedAttrs(attrs Attributes) Attributes {
+	sorted := slices.Clone(attrs)
+	slices.SortStableFunc(sorted, func(a, b *Attr) int { return strings.Compare(a.Name, b.Name) })
+	return sorted
+}
+
+// checkEncodable reports the first required field the encoder would fill with a default.
+func checkEncodable(s *Session) error {
+	switch {
+	case s.Origin == nil:
+		return fmt.Errorf("cannot encode session: missing origin")
+	case s.Origin.Username == "":
+		return fmt.Errorf("cannot encode session: missing origin username")
+	case s.Name == "":
+		return fmt.Errorf("cannot encode session: missing session name")
+	}
+	if err := checkTransport("origin", s.Origin.Network, s.Origin.Type, s.Origin.Address); err != nil {
+		return err
+	}
+	if c := s.Connection; c != nil {
+		if err := checkTransport("connection", c.Network, c.Type, c.Address); err != nil {
+			return err
+		}
+	}
+	if err := checkAttrs(s.Attributes); err != nil {
+		return err
+	}
+	for i, m := range s.Media {
+		switch {
+		case m.Type == "":
+			return fmt.Errorf("cannot encode session: missing type of media %d", i)
+		case m.Proto == "":
+			return fmt.Errorf("cannot encode session: missing protocol of %s media %d", m.Type, i)
+		case m.FormatDescr == "" && len(m.Formats) == 0:
+			return fmt.Errorf("cannot encode session: missing formats of %s media %d", m.Type, i)
+		}
+		for _, c := range m.Connection {
+			if err := checkTransport(m.Type+" connection", c.Network, c.Type, c.Address); err != nil {
+				return err
+			}
+		}
+		if err := checkAttrs(m.Attributes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTransport(field, network, typ, addr string) error {
+	if network == "" || typ == "" || addr == "" {
+		return fmt.Errorf("cannot encode session: incomplete %s %q %q %q", field, network, typ, addr)
+	}
+	return nil
+}
+
+func checkAttrs(attrs Attributes) error {
+	for _, a := range attrs {
+		if a.Name == "" {
+			return fmt.Errorf("cannot encode session: attribute without name (value %q)", a.Value)
+		}
+	}
+	return nil
+}
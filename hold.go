@@ -0,0 +1,203 @@
+package sdp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HoldState classifies the direction of a received media line.
+type HoldState string
+
+const (
+	HoldStateActive     HoldState = "active"      // sendrecv
+	HoldStateSendOnly   HoldState = "sendonly"    // peer holds the media (RFC 6337 §5.1)
+	HoldStateRecvOnly   HoldState = "recvonly"    // peer only receives, e.g. answering our hold
+	HoldStateInactive   HoldState = "inactive"    // no media either way
+	HoldStateLegacyHold HoldState = "legacy-hold" // c=0.0.0.0 hold (RFC 2543)
+	HoldStateDisabled   HoldState = "disabled"    // port 0
+)
+
+// IsHeld reports whether the peer has put the media on hold in this state: it no longer receives
+// media (sendonly, e.g. while playing music on hold), or the stream is inactive or uses a legacy hold.
+func (hs HoldState) IsHeld() bool {
+	switch hs {
+	case HoldStateSendOnly, HoldStateInactive, HoldStateLegacyHold:
+		return true
+	}
+	return false
+}
+
+// GetEffectiveDirective returns the direction of the media, inheriting the session level one
+// and defaulting to sendrecv (RFC 3264 §5.1).
+func (ses *Session) GetEffectiveDirective(m *Media) string {
+	if m.Mode != "" {
+		return m.Mode
+	}
+	if ses.Mode != "" {
+		return ses.Mode
+	}
+	return SendRecv
+}
+
+// ClassifyHold returns the hold state of media m of a received description.
+func (ses *Session) ClassifyHold(m *Media) HoldState {
+	if m.Port == 0 {
+		return HoldStateDisabled
+	}
+	if isNullAddress(ses.GetEffectiveMediaIPv4(m)) {
+		return HoldStateLegacyHold
+	}
+	switch ses.GetEffectiveDirective(m) {
+	case SendOnly:
+		return HoldStateSendOnly
+	case RecvOnly:
+		return HoldStateRecvOnly
+	case Inactive:
+		return HoldStateInactive
+	}
+	return HoldStateActive
+}
+
+// HoldStates returns the hold state of every media line of a received description.
+func (ses *Session) HoldStates() []HoldState {
+	states := make([]HoldState, len(ses.Media))
+	for i, m := range ses.Media {
+		states[i] = ses.ClassifyHold(m)
+	}
+	return states
+}
+
+func isNullAddress(addr string) bool {
+	return addr == "0.0.0.0" || addr == "::"
+}
+
+// Hold returns a re-offer putting every active media line of the local description on hold, following
+// RFC 6337: sendrecv becomes sendonly, recvonly becomes inactive, held lines are kept.
+// The connection address is only set to 0.0.0.0 when legacy is true. The origin version is incremented.
+func (ses *Session) Hold(legacy bool) (*Session, error) {
+	if ses.Origin == nil {
+		return nil, fmt.Errorf("cannot build hold re-offer: missing origin")
+	}
+	offer := ses.Clone()
+	for _, m := range offer.Media {
+		if m.Port == 0 {
+			continue
+		}
+		mode := offer.GetEffectiveDirective(m)
+		if next, ok := GetSubsequentMediaDirectiveMode(mode, true); ok {
+			mode = next
+		}
+		m.Mode = mode
+		if legacy {
+			m.Connection = []*Connection{{Network: NetworkInternet, Type: TypeIPv4, Address: "0.0.0.0"}}
+		}
+	}
+	offer.Mode = ""
+	return offer.BumpVersion(), nil
+}
+
+// Resume returns a re-offer taking every active media line of the local description off hold:
+// sendonly becomes sendrecv and inactive becomes recvonly. Lines held with a 0.0.0.0 connection get
+// addr as their connection address, so addr is required after a legacy hold.
+// The origin version is incremented.
+func (ses *Session) Resume(addr string) (*Session, error) {
+	if ses.Origin == nil {
+		return nil, fmt.Errorf("cannot build resume re-offer: missing origin")
+	}
+	offer := ses.Clone()
+	for _, m := range offer.Media {
+		if m.Port == 0 {
+			continue
+		}
+		if isNullAddress(offer.GetEffectiveMediaIPv4(m)) {
+			if addr == "" {
+				return nil, fmt.Errorf("cannot build resume re-offer: %s media held with null address and no address given", m.Type)
+			}
+			m.Connection = []*Connection{newConnection(addr)}
+		}
+		mode := offer.GetEffectiveDirective(m)
+		if next, ok := GetSubsequentMediaDirectiveMode(mode, false); ok {
+			mode = next
+		}
+		m.Mode = mode
+	}
+	offer.Mode = ""
+	return offer.BumpVersion(), nil
+}
+
+// IsMediaHeld reports whether the peer has put m on hold (see HoldState.IsHeld), or disabled it.
+func (ses *Session) IsMediaHeld(m *Media) bool {
+	state := ses.ClassifyHold(m)
+	return state == HoldStateDisabled || state.IsHeld()
+}
+
+// HoldSummary describes the hold state of every media line, e.g. "audio held, video active".
+func (ses *Session) HoldSummary() string {
+	parts := make([]string, len(ses.Media))
+	for i, m := range ses.Media {
+		state := ses.ClassifyHold(m)
+		switch {
+		case state.IsHeld():
+			parts[i] = m.Type + " held"
+		case state == HoldStateDisabled:
+			parts[i] = m.Type + " disabled"
+		case state == HoldStateRecvOnly:
+			parts[i] = m.Type + " recvonly"
+		default:
+			parts[i] = m.Type + " active"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DirectionAsymmetry classifies the direction of an answered media line against its offer.
+type DirectionAsymmetry string
+
+const (
+	DirectionMatched  DirectionAsymmetry = "matched"  // answer mirrors the offer (sendrecv/sendrecv, sendonly/recvonly, ...)
+	DirectionNarrowed DirectionAsymmetry = "narrowed" // answer is valid but more restrictive, e.g. sendrecv answered recvonly
+	DirectionInvalid  DirectionAsymmetry = "invalid"  // answer not permitted by the offer (RFC 3264 §6.1)
+	DirectionRejected DirectionAsymmetry = "rejected" // media line rejected or disabled
+)
+
+// CompareDirections classifies the direction of every answered media line against the offer.
+func CompareDirections(offer, answer *Session) ([]DirectionAsymmetry, error) {
+	if len(offer.Media) != len(answer.Media) {
+		return nil, fmt.Errorf("cannot compare directions: media count mismatch (%d vs %d)", len(offer.Media), len(answer.Media))
+	}
+	result := make([]DirectionAsymmetry, len(offer.Media))
+	for i, mo := range offer.Media {
+		ma := answer.Media[i]
+		if mo.Port == 0 || ma.Port == 0 {
+			result[i] = DirectionRejected
+			continue
+		}
+		result[i] = classifyDirections(offer.GetEffectiveDirective(mo), answer.GetEffectiveDirective(ma))
+	}
+	return result, nil
+}
+
+func classifyDirections(offered, answered string) DirectionAsymmetry {
+	if answered == mirrorDirection(offered) {
+		return DirectionMatched
+	}
+	switch offered {
+	case SendRecv:
+		return DirectionNarrowed
+	case SendOnly, RecvOnly:
+		if answered == Inactive {
+			return DirectionNarrowed
+		}
+	}
+	return DirectionInvalid
+}
+
+func mirrorDirection(mode string) string {
+	switch mode {
+	case SendOnly:
+		return RecvOnly
+	case RecvOnly:
+		return SendOnly
+	}
+	return mode
+}
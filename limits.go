@@ -0,0 +1,122 @@
+package sdp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DecoderOptions limits the resources used to decode untrusted input. Zero values mean no limit,
+// except MaxLineSize that defaults to 1024 bytes.
+type DecoderOptions struct {
+	MaxBodySize   int // total bytes read
+	MaxLineSize   int
+	MaxLines      int
+	MaxMedia      int
+	MaxAttributes int // a= lines of the whole description
+	MaxFormats    int // formats of an m= line
+	MaxCandidates int // ICE candidates of a section
+}
+
+// LimitError is returned, wrapped in a *DecodeError, when the input exceeds a DecoderOptions limit.
+type LimitError struct {
+	Limit string // name of the DecoderOptions field, e.g. "MaxMedia"
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeded", e.Limit, e.Max)
+}
+
+// NewDecoderOptions returns a new decoder that reads from r within the limits of opts.
+func NewDecoderOptions(r io.Reader, opts DecoderOptions) *Decoder {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = maxLineSize
+	}
+	if opts.MaxBodySize > 0 {
+		r = &limitReader{r: r, n: opts.MaxBodySize, max: opts.MaxBodySize}
+	}
+	return &Decoder{r: newReader(r, opts.MaxLineSize), opts: opts}
+}
+
+// NewDecoderStringOptions returns a new decoder that reads from s within the limits of opts.
+func NewDecoderStringOptions(s string, opts DecoderOptions) *Decoder {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = maxLineSize
+	}
+	d := &Decoder{r: &stringReader{s: s, max: opts.MaxLineSize}, opts: opts}
+	if opts.MaxBodySize > 0 && len(s) > opts.MaxBodySize {
+		d.r = &errReader{&LimitError{"MaxBodySize", opts.MaxBodySize}}
+	}
+	return d
+}
+
+// limits counts the elements of the description being decoded.
+type limits struct {
+	media, attrs, candidates int
+}
+
+func (d *Decoder) checkLimits(f byte, v string) error {
+	o := &d.opts
+	if o.MaxLines > 0 && d.line > o.MaxLines {
+		return &LimitError{"MaxLines", o.MaxLines}
+	}
+	switch f {
+	case 'm':
+		d.count.media++
+		d.count.candidates = 0
+		if o.MaxMedia > 0 && d.count.media > o.MaxMedia {
+			return &LimitError{"MaxMedia", o.MaxMedia}
+		}
+		if o.MaxFormats > 0 && len(strings.Fields(v))-3 > o.MaxFormats {
+			return &LimitError{"MaxFormats", o.MaxFormats}
+		}
+	case 'a':
+		d.count.attrs++
+		if o.MaxAttributes > 0 && d.count.attrs > o.MaxAttributes {
+			return &LimitError{"MaxAttributes", o.MaxAttributes}
+		}
+		if strings.HasPrefix(v, "candidate:") {
+			d.count.candidates++
+			if o.MaxCandidates > 0 && d.count.candidates > o.MaxCandidates {
+				return &LimitError{"MaxCandidates", o.MaxCandidates}
+			}
+		}
+	}
+	return nil
+}
+
+// limitReader fails with a *LimitError after n bytes instead of returning io.EOF.
+type limitReader struct {
+	r      io.Reader
+	n, max int
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// probe for more input
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 {
+			return 0, err
+		}
+		return 0, &LimitError{"MaxBodySize", l.max}
+	}
+	if len(p) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= n
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) ReadLine() (string, error) {
+	return "", r.err
+}
+
+func (r *errReader) EOL() string {
+	return ""
+}
@@ -0,0 +1,101 @@
+package sdp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// Content-Disposition of a session description in a SIP body (RFC 3261 §20.11).
+const DispositionSession = "session"
+
+// BodyPart is a part of a multipart SIP body (RFC 5621), e.g. SIPREC metadata, ISUP or PIDF.
+type BodyPart struct {
+	ContentType string
+	Disposition string // Content-Disposition, optional
+	Body        []byte
+}
+
+// ExtractSDP returns the first application/sdp part of a SIP body with the given Content-Type,
+// searching nested multipart bodies. A plain application/sdp body is returned as is.
+func ExtractSDP(contentType string, body []byte) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("cannot extract SDP: invalid content type %q: %w", contentType, err)
+	}
+	if mediaType == ContentType {
+		return body, nil
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("cannot extract SDP: unexpected content type %s", mediaType)
+	}
+
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("cannot extract SDP: no %s part in %s body", ContentType, mediaType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot extract SDP: %w", err)
+		}
+		partType := part.Header.Get("Content-Type")
+		if partType == "" {
+			// RFC 2046 §5.1 default
+			continue
+		}
+		if pt, _, err := mime.ParseMediaType(partType); err != nil || pt != ContentType && !strings.HasPrefix(pt, "multipart/") {
+			continue
+		}
+		b, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("cannot extract SDP: %w", err)
+		}
+		if sdp, err := ExtractSDP(partType, b); err == nil {
+			return sdp, nil
+		}
+	}
+}
+
+// ParseBody parses the session description of a SIP body, plain or multipart.
+func ParseBody(contentType string, body []byte, restoreMissingPTs bool) (*Session, []string, error) {
+	b, err := ExtractSDP(contentType, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Parse(b, restoreMissingPTs)
+}
+
+// BuildMultipart encodes the session as the first part of a multipart body of the given subtype
+// ("mixed" or "alternative"), followed by parts. It returns the Content-Type header value with
+// the generated boundary and the body.
+func (ses *Session) BuildMultipart(subtype string, parts ...*BodyPart) (string, []byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	all := append([]*BodyPart{{ContentType: ContentType, Disposition: DispositionSession, Body: ses.Bytes()}}, parts...)
+	for _, p := range all {
+		if p.ContentType == "" {
+			return "", nil, fmt.Errorf("cannot build multipart body: missing part content type")
+		}
+		h := textproto.MIMEHeader{"Content-Type": {p.ContentType}}
+		if p.Disposition != "" {
+			h.Set("Content-Disposition", p.Disposition)
+		}
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot build multipart body: %w", err)
+		}
+		if _, err := pw.Write(p.Body); err != nil {
+			return "", nil, fmt.Errorf("cannot build multipart body: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, fmt.Errorf("cannot build multipart body: %w", err)
+	}
+	contentType := mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": w.Boundary()})
+	return contentType, buf.Bytes(), nil
+}
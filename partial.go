@@ -0,0 +1,302 @@
+package sdp
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PartialSession is a session description decoded only as far as routing and NAT decisions need:
+// the origin, the connections and the media line headers. Attributes and formats are decoded
+// on first access.
+type PartialSession struct {
+	Origin     *Origin
+	Connection *Connection
+	Media      []*PartialMedia
+
+	body   string
+	lines  []partialLine // session level lines other than o= and c=
+	header *Session      // session level attributes, decoded on first access
+	full   *Session
+}
+
+// PartialMedia is a media section of a PartialSession.
+type PartialMedia struct {
+	Type       string
+	Port       int
+	PortNum    int
+	Proto      string
+	Connection []*Connection
+
+	lines []partialLine // section lines, m= included
+	media *Media
+}
+
+// partialLine is a line kept for decoding on first access, with its line number in the body.
+type partialLine struct {
+	num  int
+	text string
+}
+
+// DecodePartial decodes the origin, connections and media line headers of the session description s.
+func DecodePartial(s string) (*PartialSession, error) {
+	d := NewDecoderString(s)
+	ps := &PartialSession{body: s}
+	var media *PartialMedia
+
+	for {
+		d.line++
+		line, err := d.r.ReadLine()
+		if err != nil {
+			if err == io.EOF && ps.Origin != nil {
+				break
+			}
+			return nil, err
+		}
+		if len(line) == 0 && ps.Origin != nil {
+			break
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, newDecodeError(ErrFormat, d.line, line)
+		}
+		f, v := asciiToLowerByte(line[0]), line[2:]
+		switch {
+		case f == 'm':
+			media = new(PartialMedia)
+			err = d.partialMedia(media, v)
+			ps.Media = append(ps.Media, media)
+		case media != nil:
+			if f == 'c' {
+				var c *Connection
+				if c, err = d.connection(v); err == nil {
+					media.Connection = append(media.Connection, c)
+				}
+			}
+		case f == 'o':
+			ps.Origin, err = d.origin(v)
+		case f == 'c':
+			ps.Connection, err = d.connection(v)
+		default:
+			ps.lines = append(ps.lines, partialLine{d.line, line})
+		}
+		if err != nil {
+			return nil, newDecodeError(err, d.line, line)
+		}
+		if media != nil {
+			media.lines = append(media.lines, partialLine{d.line, line})
+		}
+	}
+	return ps, nil
+}
+
+func (d *Decoder) partialMedia(m *PartialMedia, v string) error {
+	p, ok := d.fields(v, 4)
+	if !ok {
+		return ErrFormat
+	}
+	m.Type, m.Proto = asciiToLower(p[0]), p[2]
+	p, ok = d.split(p[1], '/', 2)
+	var err error
+	if ok {
+		if m.PortNum, err = strconv.Atoi(p[1]); err != nil {
+			return err
+		}
+	}
+	m.Port, err = strconv.Atoi(p[0])
+	return err
+}
+
+// Attributes decodes the session level attributes. The direction and packet time attributes
+// are returned by Mode and Packetization.
+func (ps *PartialSession) Attributes() (Attributes, error) {
+	ses, err := ps.decodeHeader()
+	if err != nil {
+		return nil, err
+	}
+	return ses.Attributes, nil
+}
+
+// Mode returns the session level direction ("sendrecv", "recvonly", "sendonly" or "inactive"),
+// or "" if none is signalled.
+func (ps *PartialSession) Mode() (string, error) {
+	ses, err := ps.decodeHeader()
+	if err != nil {
+		return "", err
+	}
+	return ses.Mode, nil
+}
+
+// Packetization returns the session level ptime and maxptime.
+func (ps *PartialSession) Packetization() (Packetization, error) {
+	ses, err := ps.decodeHeader()
+	if err != nil {
+		return Packetization{}, err
+	}
+	return Packetization{PTime: ses.PTime, MaxPTime: ses.MaxPTime}, nil
+}
+
+func (ps *PartialSession) decodeHeader() (*Session, error) {
+	if ps.header == nil {
+		d, ses := NewDecoderString(""), new(Session)
+		for _, line := range ps.lines {
+			if f := asciiToLowerByte(line.text[0]); f == 'a' {
+				if err := d.session(ses, f, line.text[2:]); err != nil {
+					return nil, newDecodeError(err, line.num, line.text)
+				}
+			}
+		}
+		ps.header = ses
+	}
+	return ps.header, nil
+}
+
+// Session fully decodes the session description.
+func (ps *PartialSession) Session() (*Session, error) {
+	if ps.full == nil {
+		ses, err := NewDecoderString(ps.body).Decode()
+		if err != nil {
+			return nil, err
+		}
+		ps.full = ses
+	}
+	return ps.full, nil
+}
+
+// Media fully decodes the media section, including attributes and formats.
+func (m *PartialMedia) Media() (*Media, error) {
+	if m.media == nil {
+		d := NewDecoderString("")
+		media := new(Media)
+		for _, line := range m.lines {
+			if err := d.media(media, asciiToLowerByte(line.text[0]), line.text[2:]); err != nil {
+				return nil, newDecodeError(err, line.num, line.text)
+			}
+		}
+		m.media = media
+	}
+	return m.media, nil
+}
+
+// Attributes decodes the media attributes.
+func (m *PartialMedia) Attributes() (Attributes, error) {
+	media, err := m.Media()
+	if err != nil {
+		return nil, err
+	}
+	return media.Attributes, nil
+}
+
+// Scanner answers routing questions straight from an encoded session description,
+// without decoding it.
+type Scanner string
+
+// HasMedia reports whether the description has an active media line of the given type.
+func (s Scanner) HasMedia(typ string) bool {
+	found := false
+	s.mediaLines(func(m scannedMedia) bool {
+		found = m.port > 0 && strings.EqualFold(m.typ, typ)
+		return !found
+	})
+	return found
+}
+
+// HasVideo reports whether the description has an active video line.
+func (s Scanner) HasVideo() bool {
+	return s.HasMedia(Video)
+}
+
+// IsT38 reports whether the description has an active T.38 image line (see Media.IsT38).
+func (s Scanner) IsT38() bool {
+	found := false
+	s.mediaLines(func(m scannedMedia) bool {
+		found = (&Media{Type: asciiToLower(m.typ), Port: m.port, Proto: m.proto, FormatDescr: m.formats}).IsT38()
+		return !found
+	})
+	return found
+}
+
+// MediaSocket returns the "address:port" of the first active media line of the given type, using
+// the session connection when the media has none, as Session.GetEffectiveMediaSocket.
+func (s Scanner) MediaSocket(typ string) string {
+	socket := ""
+	s.mediaLines(func(m scannedMedia) bool {
+		if m.port <= 0 || !strings.EqualFold(m.typ, typ) {
+			return true
+		}
+		if addr := cmp.Or(m.addr, m.sessAddr); addr != "" {
+			socket = fmt.Sprintf("%s:%d", addr, m.port)
+		}
+		return false
+	})
+	return socket
+}
+
+// AudioSocket returns the "address:port" of the first active audio line.
+func (s Scanner) AudioSocket() string {
+	return s.MediaSocket(Audio)
+}
+
+type scannedMedia struct {
+	typ, proto, formats string
+	port                int
+	addr, sessAddr      string
+}
+
+// mediaLines calls fn for every media line until it returns false.
+func (s Scanner) mediaLines(fn func(m scannedMedia) bool) {
+	var m scannedMedia
+	var sessAddr string
+	origin, inMedia := false, false
+	body := string(s)
+	for body != "" {
+		line, rest, _ := strings.Cut(body, "\n")
+		body = rest
+		line = strings.TrimRight(line, "\r")
+		if line == "" && origin {
+			break
+		}
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		switch v := line[2:]; asciiToLowerByte(line[0]) {
+		case 'o':
+			origin = true
+		case 'c':
+			addr := connectionAddress(v)
+			switch {
+			case !inMedia:
+				sessAddr = addr
+			case m.addr == "" && addr != "0.0.0.0":
+				m.addr = addr
+			}
+		case 'm':
+			if inMedia && !fn(m) {
+				return
+			}
+			inMedia = true
+			m = scannedMedia{sessAddr: sessAddr}
+			p := strings.SplitN(v, " ", 4)
+			if len(p) < 4 {
+				continue
+			}
+			port, _, _ := strings.Cut(p[1], "/")
+			m.typ, m.proto, m.formats = p[0], p[2], p[3]
+			m.port, _ = strconv.Atoi(port)
+		}
+	}
+	if inMedia {
+		fn(m)
+	}
+}
+
+// connectionAddress returns the address of a c= line value, without TTL and count.
+func connectionAddress(v string) string {
+	p := strings.Fields(v)
+	if len(p) < 3 {
+		return ""
+	}
+	addr, _, _ := strings.Cut(p[2], "/")
+	return addr
+}
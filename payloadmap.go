@@ -0,0 +1,345 @@
+package sdp
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+const (
+	RED = "red" // RFC 2198 redundant audio
+	RTX = "rtx" // RFC 4588 retransmission
+)
+
+// PayloadMap is a bidirectional payload type mapping of one media line between two call legs.
+type PayloadMap struct {
+	Index      int             // m-line index
+	Type       string          // media type
+	AtoB       map[uint8]uint8 // leg A payload -> leg B payload
+	BtoA       map[uint8]uint8 // leg B payload -> leg A payload
+	UnmatchedA []*Format       // formats of leg A without a counterpart in leg B
+	UnmatchedB []*Format       // formats of leg B without a counterpart in leg A
+}
+
+// Complete reports whether every format of both legs has a counterpart.
+func (pm *PayloadMap) Complete() bool {
+	return len(pm.UnmatchedA) == 0 && len(pm.UnmatchedB) == 0
+}
+
+// MapPayloadTypes matches formats of two negotiated sessions per m-line on codec name,
+// clock rate, channels and compatible fmtp, and returns one PayloadMap per m-line.
+// RED and RTX formats are matched through the payload types they reference.
+func MapPayloadTypes(a, b *Session) ([]*PayloadMap, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("cannot map payload types: nil session")
+	}
+	if len(a.Media) != len(b.Media) {
+		return nil, fmt.Errorf("cannot map payload types: media count mismatch (%d vs %d)", len(a.Media), len(b.Media))
+	}
+	maps := make([]*PayloadMap, len(a.Media))
+	for i := range a.Media {
+		ma, mb := a.Media[i], b.Media[i]
+		if ma.Type != mb.Type {
+			return nil, fmt.Errorf("cannot map payload types: media type mismatch at index %d (%s vs %s)", i, ma.Type, mb.Type)
+		}
+		maps[i] = mapMediaPayloads(ma, mb)
+		maps[i].Index = i
+	}
+	return maps, nil
+}
+
+func mapMediaPayloads(ma, mb *Media) *PayloadMap {
+	pm := &PayloadMap{
+		Type: ma.Type,
+		AtoB: make(map[uint8]uint8, len(ma.Formats)),
+		BtoA: make(map[uint8]uint8, len(mb.Formats)),
+	}
+
+	// primary codecs first, so that RED and RTX can resolve their references
+	for _, fa := range ma.Formats {
+		if isReferencingFormat(fa) {
+			continue
+		}
+		for _, fb := range mb.Formats {
+			if _, used := pm.BtoA[fb.Payload]; used || isReferencingFormat(fb) {
+				continue
+			}
+			if matchFormats(fa, fb) {
+				pm.AtoB[fa.Payload], pm.BtoA[fb.Payload] = fb.Payload, fa.Payload
+				break
+			}
+		}
+	}
+
+	for _, fa := range ma.Formats {
+		if !isReferencingFormat(fa) {
+			continue
+		}
+		for _, fb := range mb.Formats {
+			if _, used := pm.BtoA[fb.Payload]; used || !isReferencingFormat(fb) {
+				continue
+			}
+			if matchFormatHeaders(fa, fb) && matchReferences(fa, fb, pm.AtoB) {
+				pm.AtoB[fa.Payload], pm.BtoA[fb.Payload] = fb.Payload, fa.Payload
+				break
+			}
+		}
+	}
+
+	for _, f := range ma.Formats {
+		if _, ok := pm.AtoB[f.Payload]; !ok {
+			pm.UnmatchedA = append(pm.UnmatchedA, f)
+		}
+	}
+	for _, f := range mb.Formats {
+		if _, ok := pm.BtoA[f.Payload]; !ok {
+			pm.UnmatchedB = append(pm.UnmatchedB, f)
+		}
+	}
+
+	return pm
+}
+
+func isReferencingFormat(f *Format) bool {
+	switch f.LowerName() {
+	case RED, RTX:
+		return true
+	}
+	return false
+}
+
+func matchFormatHeaders(a, b *Format) bool {
+	return strings.EqualFold(a.Name, b.Name) && a.ClockRate == b.ClockRate && channelsOf(a) == channelsOf(b)
+}
+
+func matchFormats(a, b *Format) bool {
+	a, b = resolveStatic(a), resolveStatic(b)
+	return matchFormatHeaders(a, b) && compatibleFmtp(a, b)
+}
+
+// resolveStatic fills a static payload type without rtpmap from the codec table.
+func resolveStatic(f *Format) *Format {
+	if f.Name != "" || f.Payload >= DynamicPayloadStart {
+		return f
+	}
+	if cinfo, ok := codecsInfoMap[f.Payload]; ok {
+		return &Format{Payload: f.Payload, Name: cinfo.Name, ClockRate: cinfo.ClockRate, Channels: cinfo.Channels, Params: f.Params}
+	}
+	return f
+}
+
+func channelsOf(f *Format) int {
+	if f.Channels == 0 {
+		return 1
+	}
+	return f.Channels
+}
+
+// significantFmtp lists per codec the fmtp parameters that must agree (with their default values)
+// for two formats to be relayed without transcoding.
+var significantFmtp = map[string]map[string]string{
+	"h264":   {"packetization-mode": "0", "profile": ""},
+	"h265":   {"profile-id": "1"},
+	"vp9":    {"profile-id": "0"},
+	"amr":    {"octet-align": "0", "crc": "0", "robust-sorting": "0", "interleaving": ""},
+	"amr-wb": {"octet-align": "0", "crc": "0", "robust-sorting": "0", "interleaving": ""},
+	"g729":   {"annexb": "yes"},
+	"ilbc":   {"mode": "30"},
+}
+
+func compatibleFmtp(a, b *Format) bool {
+	keys, ok := significantFmtp[a.LowerName()]
+	if !ok {
+		return true
+	}
+	pa, pb := a.FmtpParams(), b.FmtpParams()
+	for k, def := range keys {
+		va, vb := fmtpValue(pa, k, def), fmtpValue(pb, k, def)
+		if !strings.EqualFold(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+func fmtpValue(params map[string]string, key, def string) string {
+	if key == "profile" {
+		// H.264 profile_idc and profile-iop, level may differ
+		v := params["profile-level-id"]
+		if len(v) >= 4 {
+			return v[:4]
+		}
+		return "42e0"
+	}
+	if v, ok := params[key]; ok {
+		return v
+	}
+	return def
+}
+
+// FmtpParams returns the fmtp parameters of the format as a map with lowercased keys.
+// Parameters without a value, such as "0-16" or "111/111", are stored with an empty value.
+func (f *Format) FmtpParams() map[string]string {
+	params := make(map[string]string)
+	for _, p := range f.Params {
+		for it := range strings.SplitSeq(p, ";") {
+			it = strings.TrimSpace(it)
+			if it == "" {
+				continue
+			}
+			if k, v, ok := strings.Cut(it, "="); ok {
+				params[asciiToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			} else {
+				params[it] = ""
+			}
+		}
+	}
+	return params
+}
+
+// referencedPayloads returns payloads referenced by RED ("111/111") or RTX ("apt=111") formats.
+func referencedPayloads(f *Format) []uint8 {
+	var pts []uint8
+	switch f.LowerName() {
+	case RED:
+		for _, p := range f.Params {
+			for it := range strings.SplitSeq(strings.TrimSpace(p), "/") {
+				if pt, err := strconv.ParseUint(it, 10, 8); err == nil {
+					pts = append(pts, uint8(pt))
+				}
+			}
+		}
+	case RTX:
+		if pt, err := strconv.ParseUint(f.FmtpParams()["apt"], 10, 8); err == nil {
+			pts = append(pts, uint8(pt))
+		}
+	}
+	return pts
+}
+
+func matchReferences(a, b *Format, atob map[uint8]uint8) bool {
+	ra, rb := referencedPayloads(a), referencedPayloads(b)
+	if len(ra) != len(rb) {
+		return false
+	}
+	for i, pt := range ra {
+		if mapped, ok := atob[pt]; !ok || mapped != rb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RewritePayloads rewrites payload types of every media line of ses using maps.
+// If toB is true, leg A payloads are translated to leg B payloads; otherwise leg B to leg A.
+func (ses *Session) RewritePayloads(maps []*PayloadMap, toB bool) error {
+	for _, pm := range maps {
+		if pm == nil || pm.Index < 0 || pm.Index >= len(ses.Media) {
+			continue
+		}
+		mapping := pm.BtoA
+		if toB {
+			mapping = pm.AtoB
+		}
+		if err := ses.Media[pm.Index].RewritePayloads(mapping); err != nil {
+			return fmt.Errorf("%w (media %d)", err, pm.Index)
+		}
+	}
+	return nil
+}
+
+// RewritePayloads translates the payload types of the media formats using mapping.
+// Since rtpmap, fmtp and rtcp-fb lines are keyed by Format.Payload they follow the format;
+// payload references inside RED and RTX fmtp parameters are rewritten as well.
+// Formats without a mapping keep their payload type, unless a mapped format takes it;
+// they are then moved to a free dynamic payload type.
+func (m *Media) RewritePayloads(mapping map[uint8]uint8) error {
+	mapping, err := m.resolvePayloadCollisions(mapping)
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Formats {
+		switch f.LowerName() {
+		case RED:
+			for i, p := range f.Params {
+				f.Params[i] = rewriteRedParams(p, mapping)
+			}
+		case RTX:
+			for i, p := range f.Params {
+				f.Params[i] = rewriteRtxParams(p, mapping)
+			}
+		}
+		if pt, ok := mapping[f.Payload]; ok {
+			f.Payload = pt
+		}
+	}
+	return nil
+}
+
+// resolvePayloadCollisions extends mapping with moves of unmapped formats whose payload type
+// is taken by a mapped one. The given mapping is not modified.
+func (m *Media) resolvePayloadCollisions(mapping map[uint8]uint8) (map[uint8]uint8, error) {
+	var used [256]bool
+	for _, f := range m.Formats {
+		if pt, ok := mapping[f.Payload]; ok {
+			used[pt] = true
+		}
+	}
+	var collisions []uint8
+	for _, f := range m.Formats {
+		if _, ok := mapping[f.Payload]; ok {
+			continue
+		}
+		if used[f.Payload] {
+			collisions = append(collisions, f.Payload)
+		}
+		used[f.Payload] = true
+	}
+	if len(collisions) == 0 {
+		return mapping, nil
+	}
+	mapping = maps.Clone(mapping)
+	for _, pt := range collisions {
+		free := DynamicPayloadStart
+		for free < 128 && used[free] {
+			free++
+		}
+		if free == 128 {
+			return nil, fmt.Errorf("no free payload type for payload type %d", pt)
+		}
+		used[free] = true
+		mapping[pt] = uint8(free)
+	}
+	return mapping, nil
+}
+
+func rewriteRedParams(p string, mapping map[uint8]uint8) string {
+	items := strings.Split(strings.TrimSpace(p), "/")
+	for i, it := range items {
+		items[i] = rewritePayloadString(it, mapping)
+	}
+	return strings.Join(items, "/")
+}
+
+func rewriteRtxParams(p string, mapping map[uint8]uint8) string {
+	items := strings.Split(p, ";")
+	for i, it := range items {
+		k, v, ok := strings.Cut(it, "=")
+		if ok && asciiToLower(strings.TrimSpace(k)) == "apt" {
+			items[i] = k + "=" + rewritePayloadString(strings.TrimSpace(v), mapping)
+		}
+	}
+	return strings.Join(items, ";")
+}
+
+func rewritePayloadString(s string, mapping map[uint8]uint8) string {
+	pt, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return s
+	}
+	if mapped, ok := mapping[uint8(pt)]; ok {
+		return strconv.Itoa(int(mapped))
+	}
+	return s
+}
@@ -0,0 +1,196 @@
+package sdp
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CodecPolicy is a reusable codec selection profile, e.g. one per trunk.
+// The top level rules apply to audio media; other media types are left as is unless Media has rules for them.
+// Telephone-event and comfort noise are exempt from Allow and the limits, but can still be denied.
+type CodecPolicy struct {
+	Allow        []string                `json:"allow,omitempty"`     // codec names allowed; empty allows all
+	Deny         []string                `json:"deny,omitempty"`      // codec names always removed
+	Weights      map[string]int          `json:"weights,omitempty"`   // higher weight ranks first; unlisted codecs weigh 0
+	Mandatory    string                  `json:"mandatory,omitempty"` // codec that must be present
+	MaxChannels  int                     `json:"maxChannels,omitempty"`
+	MinClockRate int                     `json:"minClockRate,omitempty"`
+	MaxClockRate int                     `json:"maxClockRate,omitempty"`
+	Media        map[string]*CodecPolicy `json:"media,omitempty"` // per media type rules, replacing the top level ones
+}
+
+// LoadCodecPolicy decodes a policy from JSON and validates it.
+func LoadCodecPolicy(data []byte) (*CodecPolicy, error) {
+	p := new(CodecPolicy)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("cannot load codec policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the policy for contradictions.
+func (p *CodecPolicy) Validate() error {
+	if p.Mandatory != "" {
+		if p.denies(p.Mandatory) {
+			return fmt.Errorf("invalid codec policy: mandatory codec %s is denied", p.Mandatory)
+		}
+		if len(p.Allow) > 0 && !p.allows(p.Mandatory) {
+			return fmt.Errorf("invalid codec policy: mandatory codec %s is not allowed", p.Mandatory)
+		}
+	}
+	if p.MinClockRate > 0 && p.MaxClockRate > 0 && p.MinClockRate > p.MaxClockRate {
+		return fmt.Errorf("invalid codec policy: min clock rate %d above max clock rate %d", p.MinClockRate, p.MaxClockRate)
+	}
+	for medType, rules := range p.Media {
+		if rules == nil {
+			continue
+		}
+		if err := rules.Validate(); err != nil {
+			return fmt.Errorf("%w (media %s)", err, medType)
+		}
+	}
+	return nil
+}
+
+// allows, denies and weight match names case-insensitively against the fields as they are,
+// so that changes to a policy take effect on the next call.
+func (p *CodecPolicy) allows(name string) bool {
+	return containsFold(p.Allow, name)
+}
+
+func (p *CodecPolicy) denies(name string) bool {
+	return containsFold(p.Deny, name)
+}
+
+func (p *CodecPolicy) weight(name string) int {
+	if w, ok := p.Weights[name]; ok {
+		return w
+	}
+	for k, w := range p.Weights {
+		if strings.EqualFold(k, name) {
+			return w
+		}
+	}
+	return 0
+}
+
+func containsFold(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+// rulesFor returns the rules of the media type, or nil if it has none.
+func (p *CodecPolicy) rulesFor(medType string) *CodecPolicy {
+	if rules, ok := p.Media[medType]; ok && rules != nil {
+		return rules
+	}
+	if medType == Audio {
+		return p
+	}
+	return nil
+}
+
+// Permits reports whether the format passes the allow/deny lists and limits of the policy.
+func (p *CodecPolicy) Permits(f *Format) bool {
+	f = resolveStatic(f)
+	if p.denies(f.Name) {
+		return false
+	}
+	if !f.IsAudioFormat() {
+		return true
+	}
+	if len(p.Allow) > 0 && !p.allows(f.Name) {
+		return false
+	}
+	if p.MaxChannels > 0 && channelsOf(f) > p.MaxChannels {
+		return false
+	}
+	if p.MinClockRate > 0 && f.ClockRate < p.MinClockRate {
+		return false
+	}
+	if p.MaxClockRate > 0 && f.ClockRate > p.MaxClockRate {
+		return false
+	}
+	return true
+}
+
+// ApplyOffer filters and ranks the formats of every RTP media line of an offer.
+// A missing mandatory codec is added ahead of telephone-event and comfort noise, using a free payload type.
+// Media lines left without any codec are disabled, keeping their first format.
+func (p *CodecPolicy) ApplyOffer(ses *Session) error {
+	return p.apply(ses, true)
+}
+
+// ApplyAnswer filters and ranks the formats of every RTP media line of an answer.
+// A missing mandatory codec is reported as an error.
+func (p *CodecPolicy) ApplyAnswer(ses *Session) error {
+	return p.apply(ses, false)
+}
+
+func (p *CodecPolicy) apply(ses *Session, offer bool) error {
+	for _, m := range ses.Media {
+		if m.Port == 0 || len(m.Formats) == 0 {
+			continue
+		}
+		rules := p.rulesFor(m.Type)
+		if rules == nil {
+			continue
+		}
+		first := m.Formats[0]
+		m.filterFormats(false, rules.Permits)
+
+		mandatory := rules.Mandatory
+		if mandatory != "" && !slices.ContainsFunc(m.Formats, func(f *Format) bool {
+			return strings.EqualFold(resolveStatic(f).Name, mandatory)
+		}) {
+			if !offer {
+				return fmt.Errorf("mandatory codec %s missing in %s media", mandatory, m.Type)
+			}
+			frmt, err := BuildFormatByName(mandatory)
+			if err != nil {
+				return err
+			}
+			if m.FormatByPayload(frmt.Payload) != nil {
+				pt, ok := m.freeDynamicPayload()
+				if !ok {
+					return fmt.Errorf("no free payload type for mandatory codec %s in %s media", mandatory, m.Type)
+				}
+				frmt.Payload = pt
+			}
+			i := slices.IndexFunc(m.Formats, func(f *Format) bool { return !resolveStatic(f).IsAudioFormat() })
+			if i < 0 {
+				i = len(m.Formats)
+			}
+			m.Formats = slices.Insert(m.Formats, i, frmt)
+		}
+
+		slices.SortStableFunc(m.Formats, func(a, b *Format) int {
+			return rules.weight(resolveStatic(b).Name) - rules.weight(resolveStatic(a).Name)
+		})
+
+		if !slices.ContainsFunc(m.Formats, func(f *Format) bool { return resolveStatic(f).IsAudioFormat() }) {
+			// a rejected media line still needs a format (RFC 3264 §6)
+			m.Port = 0
+			if len(m.Formats) == 0 {
+				m.Formats = append(m.Formats, first)
+			}
+		}
+	}
+	if ses.AreAllFlowsDroppedOrDisabled() {
+		return fmt.Errorf("no media left after applying codec policy")
+	}
+	return nil
+}
+
+func (m *Media) freeDynamicPayload() (uint8, bool) {
+	for pt := DynamicPayloadStart; pt < 128; pt++ {
+		if m.FormatByPayload(uint8(pt)) == nil {
+			return uint8(pt), true
+		}
+	}
+	return 0, false
+}
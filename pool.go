@@ -0,0 +1,149 @@
+package sdp
+
+import (
+	"sync"
+	"unsafe"
+)
+
+var (
+	decoderPool = sync.Pool{New: func() any { return &Decoder{pool: true} }}
+	mediaPool   = sync.Pool{New: func() any { return new(Media) }}
+	formatPool  = sync.Pool{New: func() any { return new(Format) }}
+	attrPool    = sync.Pool{New: func() any { return new(Attr) }}
+	originPool  = sync.Pool{New: func() any { return new(Origin) }}
+	connPool    = sync.Pool{New: func() any { return new(Connection) }}
+)
+
+// DecodeInto decodes the session description in b into the caller-owned ses, releasing its previous
+// content first. Media, formats, attributes, origin and connections are taken from pools and every string of ses is sliced
+// out of b without copying, so b must not be modified while ses is in use. Call Release to return
+// the objects to the pools once done.
+func DecodeInto(ses *Session, b []byte) error {
+	ses.Release()
+	d := decoderPool.Get().(*Decoder)
+	defer d.release()
+
+	d.sr = stringReader{s: unsafe.String(unsafe.SliceData(b), len(b))}
+	d.r = &d.sr
+	_, err := d.decode(ses)
+	if err != nil {
+		ses.Release()
+	}
+	return err
+}
+
+// Release returns the media, formats, attributes, origin and connections of the session to the pools used by DecodeInto
+// and resets the session, keeping its slices for reuse. Neither the session objects nor values
+// obtained from them may be used afterwards.
+func (ses *Session) Release() {
+	for _, m := range ses.Media {
+		m.release()
+	}
+	releaseAttrs(ses.Attributes)
+	if ses.Origin != nil {
+		*ses.Origin = Origin{}
+		originPool.Put(ses.Origin)
+	}
+	if ses.Connection != nil {
+		releaseConnection(ses.Connection)
+	}
+	clear(ses.Email)
+	clear(ses.Phone)
+	clear(ses.Media)
+	clear(ses.Bandwidth)
+	clear(ses.Key)
+	clear(ses.Repeat)
+	*ses = Session{
+		Email:      ses.Email[:0],
+		Phone:      ses.Phone[:0],
+		Bandwidth:  ses.Bandwidth[:0],
+		Key:        ses.Key[:0],
+		Repeat:     ses.Repeat[:0],
+		Attributes: ses.Attributes[:0],
+		Media:      ses.Media[:0],
+	}
+}
+
+// release resets a pooled decoder, so that it keeps no string of the decoded buffer, and returns it to the pool.
+func (d *Decoder) release() {
+	clear(d.p[:cap(d.p)])
+	*d = Decoder{pool: true, p: d.p[:0], mediaLines: d.mediaLines[:0]}
+	decoderPool.Put(d)
+}
+
+func (m *Media) release() {
+	for _, f := range m.Formats {
+		clear(f.Params)
+		clear(f.Feedback)
+		*f = Format{Params: f.Params[:0], Feedback: f.Feedback[:0]}
+		formatPool.Put(f)
+	}
+	releaseAttrs(m.Attributes)
+	for _, c := range m.Connection {
+		releaseConnection(c)
+	}
+	clear(m.Formats)
+	clear(m.Connection)
+	clear(m.Bandwidth)
+	clear(m.Key)
+	*m = Media{
+		Connection: m.Connection[:0],
+		Bandwidth:  m.Bandwidth[:0],
+		Key:        m.Key[:0],
+		Attributes: m.Attributes[:0],
+		Formats:    m.Formats[:0],
+	}
+	mediaPool.Put(m)
+}
+
+func releaseAttrs(attrs Attributes) {
+	for _, a := range attrs {
+		*a = Attr{}
+		attrPool.Put(a)
+	}
+	clear(attrs)
+}
+
+func releaseConnection(c *Connection) {
+	*c = Connection{}
+	connPool.Put(c)
+}
+
+func (d *Decoder) newMedia() *Media {
+	if d.pool {
+		return mediaPool.Get().(*Media)
+	}
+	return new(Media)
+}
+
+func (d *Decoder) newFormat(pt uint8) *Format {
+	if d.pool {
+		f := formatPool.Get().(*Format)
+		f.Payload = pt
+		return f
+	}
+	return &Format{Payload: pt}
+}
+
+func (d *Decoder) newAttr(name, value string) *Attr {
+	if d.pool {
+		a := attrPool.Get().(*Attr)
+		a.Name, a.Value = name, value
+		return a
+	}
+	return &Attr{name, value}
+}
+
+func (d *Decoder) newOrigin() *Origin {
+	if d.pool {
+		return originPool.Get().(*Origin)
+	}
+	return new(Origin)
+}
+
+func (d *Decoder) newConnection() *Connection {
+	if d.pool {
+		return connPool.Get().(*Connection)
+	}
+	return new(Connection)
+}
@@ -0,0 +1,212 @@
+package sdp
+
+import (
+	"slices"
+	"strings"
+)
+
+// rawSection holds the received lines of a session or media section, decoded with Decoder.Preserve.
+type rawSection struct {
+	lines []string // received lines, including their line endings
+	canon []string // canonical encoding of the section as decoded
+}
+
+// Raw reports whether the session keeps its received lines (see Decoder.Preserve).
+func (ses *Session) Raw() bool {
+	return ses.raw != nil
+}
+
+// DropRaw forgets the received lines, so the session is encoded canonically.
+func (ses *Session) DropRaw() *Session {
+	ses.raw = nil
+	for _, m := range ses.Media {
+		m.raw = nil
+	}
+	return ses
+}
+
+func (d *Decoder) preserve(sec *rawSection, s string) {
+	sec.lines = append(sec.lines, s+d.lastEOL)
+}
+
+// preserved computes the canonical lines of the decoded sections.
+func preserved(ses *Session) {
+	ses.raw.canon = canonLines(writer(nil).sessionHeader(ses))
+	for _, m := range ses.Media {
+		if m.raw != nil {
+			m.raw.canon = canonLines(writer(nil).media(m))
+		}
+	}
+}
+
+func canonLines(w writer) []string {
+	return strings.Split(strings.TrimPrefix(string(w), "\r\n"), "\r\n")
+}
+
+// sessionPreserved encodes the session keeping the received lines of unchanged sections
+// and, in changed ones, of the unchanged lines.
+func (w writer) sessionPreserved(s *Session) writer {
+	start, eol := len(w), sectionEnding(s.raw, "\r\n")
+	w = w.section(start, s.raw, canonLines(writer(nil).sessionHeader(s)), sessionOrder, eol)
+	for _, m := range s.Media {
+		if m.raw == nil {
+			for _, line := range canonLines(writer(nil).media(m)) {
+				w = w.line(start, line+eol, eol)
+			}
+			continue
+		}
+		w = w.section(start, m.raw, canonLines(writer(nil).media(m)), mediaOrder, sectionEnding(m.raw, eol))
+	}
+	return w
+}
+
+func (w writer) section(start int, raw *rawSection, cur []string, order, eol string) writer {
+	lines := raw.lines
+	if !slices.Equal(raw.canon, cur) {
+		lines = mergeLines(raw.lines, cur, order, eol)
+	}
+	for _, line := range lines {
+		w = w.line(start, line, eol)
+	}
+	return w
+}
+
+// line appends a line, first ending the previous one if it was received without a line ending.
+func (w writer) line(start int, line, eol string) writer {
+	if len(w) > start && w[len(w)-1] != '\n' {
+		w = append(w, eol...)
+	}
+	return append(w, line...)
+}
+
+// mergeLines keeps the received lines still present in the canonical lines cur, replaces changed lines
+// in place by a new line of the same kind and inserts the remaining new lines in field order.
+func mergeLines(raw, cur []string, order, eol string) []string {
+	placed := make([]bool, len(cur))
+	out := make([]string, len(raw))
+	take := func(match func(string) bool) int {
+		for i, c := range cur {
+			if !placed[i] && match(c) {
+				placed[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	// received lines kept as is
+	for i, r := range raw {
+		c := canonRaw(r)
+		if take(func(s string) bool { return s == c }) >= 0 {
+			out[i] = r
+		}
+	}
+	// changed lines replaced in place
+	for i, r := range raw {
+		if out[i] != "" {
+			continue
+		}
+		key := lineKey(canonRaw(r))
+		if j := take(func(s string) bool { return lineKey(s) == key }); j >= 0 {
+			out[i] = cur[j] + eol
+		}
+	}
+	out = slices.DeleteFunc(out, func(s string) bool { return s == "" })
+
+	// new lines after the last line of the same or an earlier field
+	for j, c := range cur {
+		if placed[j] {
+			continue
+		}
+		rank, pos := fieldRank(order, c), 0
+		for i, o := range out {
+			if fieldRank(order, o) <= rank {
+				pos = i + 1
+			}
+		}
+		out = slices.Insert(out, pos, c+eol)
+	}
+	return out
+}
+
+// canonRaw approximates the canonical form of a received line, as the decoder lowercases
+// field letters, media types and attribute names.
+func canonRaw(r string) string {
+	r = strings.TrimRight(r, "\r\n")
+	if len(r) < 2 || r[1] != '=' {
+		return r
+	}
+	f, v := asciiToLowerByte(r[0]), r[2:]
+	switch f {
+	case 'm':
+		if typ, rest, ok := strings.Cut(v, " "); ok {
+			v = asciiToLower(typ) + " " + rest
+		}
+	case 'a':
+		if name, value, ok := strings.Cut(v, ":"); ok {
+			name = asciiToLower(name)
+			if name == PTime || name == MaxPTime {
+				if d, err := new(Decoder).ptime(value); err == nil {
+					value = string(writer(nil).ptime(d))
+				}
+			}
+			v = name + ":" + value
+		}
+	}
+	return string(f) + "=" + v
+}
+
+// lineKey identifies the element of a canonical line, e.g. "a=rtpmap 96" or "b=AS".
+func lineKey(line string) string {
+	if len(line) < 2 {
+		return line
+	}
+	switch line[0] {
+	case 'a':
+		name, value, _ := strings.Cut(line, ":")
+		switch name {
+		case "a=rtpmap", "a=fmtp", "a=rtcp-fb":
+			pt, _, _ := strings.Cut(value, " ")
+			return name + " " + pt
+		case "a=" + SendRecv, "a=" + SendOnly, "a=" + RecvOnly, "a=" + Inactive:
+			return "a=mode"
+		}
+		return name
+	case 'b':
+		typ, _, _ := strings.Cut(line, ":")
+		return typ
+	}
+	return line[:2]
+}
+
+func fieldRank(order, line string) int {
+	if line == "" {
+		return len(order)
+	}
+	rank := strings.IndexByte(order, asciiToLowerByte(line[0]))
+	if line[0] == 'r' {
+		rank = strings.IndexByte(order, 't')
+	}
+	if rank < 0 {
+		return len(order)
+	}
+	return rank
+}
+
+// sectionEnding returns the line ending of the first received line of a section, or def.
+func sectionEnding(raw *rawSection, def string) string {
+	if len(raw.lines) == 0 || !strings.HasSuffix(raw.lines[0], "\n") {
+		return def
+	}
+	return lineEnding(raw.lines[0])
+}
+
+func lineEnding(line string) string {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return "\n"
+	}
+	return "\r\n"
+}
@@ -0,0 +1,144 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPTime is the packet time assumed for audio when none is signalled (RFC 3551).
+const DefaultPTime = 20 * time.Millisecond
+
+// standardPTimes are the candidate packet times tried during negotiation, in order of preference.
+var standardPTimes = []time.Duration{
+	20 * time.Millisecond,
+	30 * time.Millisecond,
+	10 * time.Millisecond,
+	40 * time.Millisecond,
+	60 * time.Millisecond,
+	50 * time.Millisecond,
+	80 * time.Millisecond,
+	90 * time.Millisecond,
+	120 * time.Millisecond,
+}
+
+// Packetization holds the ptime and maxptime signalled for a media line; zero means not signalled.
+type Packetization struct {
+	PTime    time.Duration
+	MaxPTime time.Duration
+}
+
+// EffectivePTime returns the ptime of the media, inheriting the session level value (RFC 8866 §6.4).
+// It returns 0 if neither level signals a ptime.
+func (ses *Session) EffectivePTime(m *Media) time.Duration {
+	if m != nil && m.PTime > 0 {
+		return m.PTime
+	}
+	return ses.PTime
+}
+
+// EffectiveMaxPTime returns the maxptime of the media, inheriting the session level value.
+// It returns 0 if neither level signals a maxptime.
+func (ses *Session) EffectiveMaxPTime(m *Media) time.Duration {
+	if m != nil && m.MaxPTime > 0 {
+		return m.MaxPTime
+	}
+	return ses.MaxPTime
+}
+
+// Packetization returns the effective ptime and maxptime of the media.
+func (ses *Session) Packetization(m *Media) Packetization {
+	return Packetization{PTime: ses.EffectivePTime(m), MaxPTime: ses.EffectiveMaxPTime(m)}
+}
+
+// IsValidPTime reports whether the packet time is a valid packetization of the format, as per FrameSize.
+// Fractional packet times are valid for the codecs with 2.5 ms frames, i.e. opus (2.5 ms) and G.728.
+// Codecs FrameSize has no model for are reported invalid.
+func IsValidPTime(f *Format, ptime time.Duration) bool {
+	return validPTime(formatCodecInfo(f), ptime) == nil
+}
+
+func validPTime(cinfo CodecInfo, ptime time.Duration) error {
+	if ptime <= 0 {
+		return fmt.Errorf("invalid ptime %s", ptime)
+	}
+	opus := strings.EqualFold(cinfo.Name, "opus")
+	if ptime%time.Millisecond != 0 {
+		switch {
+		case opus && ptime == 2500*time.Microsecond:
+			return nil
+		case strings.EqualFold(cinfo.Name, "G728") && ptime%(2500*time.Microsecond) == 0:
+			return nil
+		}
+		return fmt.Errorf("invalid ptime %s for %s", ptime, cinfo.Name)
+	}
+	if opus && ptime == 2*time.Millisecond {
+		// FrameSize stands for 2.5 ms with 2
+		return fmt.Errorf("invalid ptime %s for %s", ptime, cinfo.Name)
+	}
+	_, err := FrameSize(cinfo, int(ptime/time.Millisecond), defaultModeKbps(cinfo.Name))
+	return err
+}
+
+// formatCodecInfo builds a CodecInfo from a negotiated format, completing it from the codec table.
+func formatCodecInfo(f *Format) CodecInfo {
+	f = resolveStatic(f)
+	cinfo, _ := GetCodecByName(f.Name)
+	cinfo.Name = f.Name
+	if f.ClockRate > 0 {
+		cinfo.ClockRate = f.ClockRate
+	}
+	cinfo.Channels = channelsOf(f)
+	return cinfo
+}
+
+// defaultModeKbps returns the mode used for multi-mode codecs when none is known.
+func defaultModeKbps(name string) float64 {
+	switch asciiToLower(name) {
+	case "g723":
+		return 6.3
+	case "amr":
+		return 12.2
+	case "amr-wb":
+		return 23.85
+	}
+	return 0
+}
+
+// NegotiatePTime picks a packet time for format f acceptable to both sides and valid for the codec.
+// The remote ptime is preferred, then the local one, then the standard packet times; none may exceed
+// the smallest maxptime signalled by either side. For codecs FrameSize has no model for (e.g. GSM),
+// any of these packet times is accepted.
+func NegotiatePTime(f *Format, local, remote Packetization) (time.Duration, error) {
+	limit := minNonZero(local.MaxPTime, remote.MaxPTime)
+	cinfo := formatCodecInfo(f)
+
+	candidates := make([]time.Duration, 0, 2+len(standardPTimes))
+	for _, pt := range []time.Duration{remote.PTime, local.PTime} {
+		if pt > 0 {
+			candidates = append(candidates, pt)
+		}
+	}
+	candidates = append(candidates, standardPTimes...)
+
+	for _, pt := range candidates {
+		if limit > 0 && pt > limit {
+			continue
+		}
+		if err := validPTime(cinfo, pt); err == nil || errors.Is(err, errNoFrameSize) {
+			return pt, nil
+		}
+	}
+	return 0, fmt.Errorf("no valid ptime for %s within maxptime %s", f.Name, limit)
+}
+
+func minNonZero(a, b time.Duration) time.Duration {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	}
+	return min(a, b)
+}
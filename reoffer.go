@@ -0,0 +1,119 @@
+package sdp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MediaAllocator returns the local address and port to use for a new media line of the given type.
+type MediaAllocator func(medType string) (addr string, port int, err error)
+
+// G.711 passthrough hints (RFC 3108): no silence suppression and no echo cancellation.
+const (
+	SilenceSupp    = "silenceSupp"
+	Ecan           = "ecan"
+	silenceSuppOff = "off - - - -"
+	ecanOff        = "fb off -"
+)
+
+// BumpVersion increments the origin version, as required for every modified offer (RFC 3264 §8).
+func (ses *Session) BumpVersion() *Session {
+	if ses.Origin != nil {
+		ses.Origin.SessionVersion++
+	}
+	return ses
+}
+
+// BuildT38ReOffer returns a re-offer derived from the current local description that replaces the
+// first audio line with an "image udptl t38" line using params and an address/port from alloc.
+// The m-line position is kept and the origin version is incremented.
+func (ses *Session) BuildT38ReOffer(params *T38Params, alloc MediaAllocator) (*Session, error) {
+	if params == nil {
+		return nil, fmt.Errorf("cannot build T.38 re-offer: nil T.38 parameters")
+	}
+	idx := ses.mediaIndex(func(m *Media) bool { return m.Type == Audio && m.Port > 0 })
+	if idx < 0 {
+		return nil, fmt.Errorf("cannot build T.38 re-offer: no active audio media flow found")
+	}
+	image := &Media{
+		Type:        Image,
+		Proto:       Udptl,
+		FormatDescr: T38FormatDescr,
+		Attributes:  params.Attributes(),
+	}
+	return ses.buildReplacementOffer(idx, image, alloc)
+}
+
+// BuildG711FallbackReOffer returns a re-offer that replaces the T.38 line (or, without one, the first
+// audio line) with a G.711 passthrough audio line: PCMU and PCMA only, 20 ms packets, silence
+// suppression and echo cancellation disabled. The origin version is incremented.
+func (ses *Session) BuildG711FallbackReOffer(alloc MediaAllocator) (*Session, error) {
+	idx := ses.mediaIndex(func(m *Media) bool { return m.IsT38() })
+	if idx < 0 {
+		idx = ses.mediaIndex(func(m *Media) bool { return m.Type == Audio && m.Port > 0 })
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("cannot build G.711 fallback re-offer: no T.38 or audio media flow found")
+	}
+
+	formats := make([]*Format, 0, 2)
+	for _, pt := range []uint8{PCMU, PCMA} {
+		frmt, err := BuildFormat(pt)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, frmt)
+	}
+	audio := &Media{
+		Type:       Audio,
+		Proto:      RtpAvp,
+		PTime:      DefaultPTime,
+		Formats:    formats,
+		Attributes: Attributes{NewAttr(SilenceSupp, silenceSuppOff), NewAttr(Ecan, ecanOff)},
+	}
+	if prev := ses.Media[idx]; prev.Type == Audio && strings.HasPrefix(prev.Proto, "RTP/") {
+		audio.Proto = prev.Proto
+	}
+	return ses.buildReplacementOffer(idx, audio, alloc)
+}
+
+func (ses *Session) mediaIndex(match func(m *Media) bool) int {
+	for i, m := range ses.Media {
+		if match(m) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ses *Session) buildReplacementOffer(idx int, media *Media, alloc MediaAllocator) (*Session, error) {
+	if ses.Origin == nil {
+		return nil, fmt.Errorf("cannot build re-offer: missing origin")
+	}
+	if alloc == nil {
+		return nil, fmt.Errorf("cannot build re-offer: nil media allocator")
+	}
+	addr, port, err := alloc(media.Type)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build re-offer: %w", err)
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("cannot build re-offer: invalid port %d", port)
+	}
+	media.Port = port
+	if addr != "" {
+		media.Connection = []*Connection{newConnection(addr)}
+	}
+
+	offer := ses.Clone()
+	offer.Media[idx] = media
+	return offer.BumpVersion(), nil
+}
+
+func newConnection(addr string) *Connection {
+	typ := TypeIPv4
+	if strings.Contains(addr, ":") {
+		typ = TypeIPv6
+	}
+	return &Connection{Network: NetworkInternet, Type: typ, Address: addr}
+}
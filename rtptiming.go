@@ -0,0 +1,69 @@
+package sdp
+
+import (
+	"fmt"
+	"time"
+)
+
+// RTPTiming describes the packetization of a negotiated format as needed by an RTP engine.
+type RTPTiming struct {
+	PTime              time.Duration
+	ClockRate          int    // RTP timestamp clock rate
+	SampleRate         int    // codec sampling rate; differs from ClockRate for G.722
+	Channels           int    // interleaved channels
+	SamplesPerPacket   int    // samples per channel at SampleRate
+	TimestampIncrement uint32 // RTP timestamp ticks per packet
+	PayloadBytes       int    // RTP payload size, 0 when variable (e.g. opus, video)
+}
+
+// GetRTPTiming derives the RTP packetization of format f sent every ptime.
+// The timestamp increment is based on the RTP clock of the format, so G.722 advances by 8 kHz
+// while sampling at 16 kHz, and telephone-event follows its own clock (e.g. 48 kHz next to opus).
+func GetRTPTiming(f *Format, ptime time.Duration) (*RTPTiming, error) {
+	if f == nil {
+		return nil, fmt.Errorf("cannot get RTP timing: nil format")
+	}
+	if ptime <= 0 {
+		return nil, fmt.Errorf("cannot get RTP timing: invalid ptime %s", ptime)
+	}
+	cinfo := formatCodecInfo(f)
+	if cinfo.ClockRate <= 0 {
+		return nil, fmt.Errorf("cannot get RTP timing: unknown clock rate for %s", f.Name)
+	}
+
+	t := &RTPTiming{
+		PTime:      ptime,
+		ClockRate:  cinfo.ClockRate,
+		SampleRate: samplingRate(cinfo),
+		Channels:   cinfo.Channels,
+	}
+
+	ticks := int64(t.ClockRate) * int64(ptime)
+	if ticks%int64(time.Second) != 0 {
+		return nil, fmt.Errorf("ptime %s is not a whole number of %d Hz clock ticks", ptime, t.ClockRate)
+	}
+	t.TimestampIncrement = uint32(ticks / int64(time.Second))
+	t.SamplesPerPacket = int(int64(t.SampleRate) * int64(ptime) / int64(time.Second))
+
+	if ptime%time.Millisecond == 0 {
+		size, err := FrameSize(cinfo, int(ptime/time.Millisecond), defaultModeKbps(cinfo.Name))
+		if err != nil {
+			if _, known := GetCodecByName(cinfo.Name); known {
+				return nil, err
+			}
+			size = 0
+		}
+		t.PayloadBytes = size
+	}
+
+	return t, nil
+}
+
+// samplingRate returns the actual sampling rate of a codec.
+// G.722 samples at 16 kHz but keeps an 8 kHz RTP clock for historical reasons (RFC 3551 §4.5.2).
+func samplingRate(c CodecInfo) int {
+	if asciiToLower(c.Name) == "g722" && c.ClockRate == 8000 {
+		return 16000
+	}
+	return c.ClockRate
+}
@@ -16,23 +16,26 @@ const deltaRune rune = 'a' - 'A'
 
 // Session represents an SDP session description.
 type Session struct {
-	Version     int          // Protocol Version ("v=")
-	Origin      *Origin      // Origin ("o=")
-	Name        string       // Session Name ("s=")
-	Information string       // Session Information ("i=")
-	URI         string       // URI ("u=")
-	Email       []string     // Email Address ("e=")
-	Phone       []string     // Phone Number ("p=")
-	Connection  *Connection  // Connection Data ("c=")
-	Bandwidth   []*Bandwidth // Bandwidth ("b=")
-	TimeZone    []*TimeZone  // TimeZone ("z=")
-	Key         []*Key       // Encryption Keys ("k=")
-	Timing      *Timing      // Timing ("t=")
-	Repeat      []*Repeat    // Repeat Times ("r=")
-	Attributes  Attributes   // Session Attributes ("a=")
-	Mode        string       // Streaming mode ("sendrecv", "recvonly", "sendonly", or "inactive")
-	PTime       string       // ptime:20 20ms
-	Media       []*Media     // Media Descriptions ("m=")
+	Version     int           // Protocol Version ("v=")
+	Origin      *Origin       // Origin ("o=")
+	Name        string        // Session Name ("s=")
+	Information string        // Session Information ("i=")
+	URI         string        // URI ("u=")
+	Email       []string      // Email Address ("e=")
+	Phone       []string      // Phone Number ("p=")
+	Connection  *Connection   // Connection Data ("c=")
+	Bandwidth   []*Bandwidth  // Bandwidth ("b=")
+	TimeZone    []*TimeZone   // TimeZone ("z=")
+	Key         []*Key        // Encryption Keys ("k=")
+	Timing      *Timing       // Timing ("t=")
+	Repeat      []*Repeat     // Repeat Times ("r=")
+	Attributes  Attributes    // Session Attributes ("a=")
+	Mode        string        // Streaming mode ("sendrecv", "recvonly", "sendonly", or "inactive")
+	PTime       time.Duration // Packet time ("a=ptime")
+	MaxPTime    time.Duration // Maximum packet time ("a=maxptime")
+	Media       []*Media      // Media Descriptions ("m=")
+
+	raw *rawSection // received lines, see Decoder.Preserve
 }
 
 func (s *Session) Clone() *Session {
@@ -47,6 +50,8 @@ func (s *Session) Clone() *Session {
 		URI:         s.URI,
 		Mode:        s.Mode,
 		PTime:       s.PTime,
+		MaxPTime:    s.MaxPTime,
+		raw:         s.raw,
 	}
 
 	// Clone Origin
@@ -248,7 +253,7 @@ func NewSessionSDP(sesID, sesVer int64, ipv4, nm, ssrc, mdir string, port int, c
 					return nil
 				}(),
 				Mode:    mdir,
-				PTime:   "20",
+				PTime:   20 * time.Millisecond,
 				Formats: formats,
 			},
 		},
@@ -293,17 +298,12 @@ func (ses *Session) GetAudioMediaFlow() *Media {
 	return ses.GetMediaFlow(Audio)
 }
 
-func (ses *Session) GetEffectivePTime() string {
-	media := ses.GetAudioMediaFlow()
-	ptValue := media.PTime
-	if ptValue != "" {
-		return ptValue
+// GetEffectivePTime returns the effective ptime of the first audio flow, defaulting to 20ms.
+func (ses *Session) GetEffectivePTime() time.Duration {
+	if pt := ses.EffectivePTime(ses.GetAudioMediaFlow()); pt > 0 {
+		return pt
 	}
-	ptValue = ses.PTime
-	if ptValue != "" {
-		return ptValue
-	}
-	return "20"
+	return DefaultPTime
 }
 
 func (ses *Session) GetEffectiveMediaIPv4(media *Media) string {
@@ -527,43 +527,35 @@ func (ses *Session) AreAllFlowsDroppedOrDisabled() bool {
 }
 
 func (ses *Session) IsT38Image() bool {
-	for _, media := range ses.Media {
-		if media.Type == Image && media.Port > 0 && media.Proto == Udptl && media.FormatDescr == "t38" {
-			return true
-		}
-	}
-	return false
+	return ses.GetT38MediaFlow() != nil
 }
 
+// GetEffectiveMediaDirective returns the effective direction of the first audio flow.
+// Use GetEffectiveDirective for other media lines.
 func (ses *Session) GetEffectiveMediaDirective() string {
 	media := ses.GetAudioMediaFlow()
-	if media != nil && media.Mode != "" {
-		return media.Mode
-	}
-	if ses.Mode != "" {
-		return ses.Mode
+	if media == nil {
+		return cmp.Or(ses.Mode, SendRecv)
 	}
-	return SendRecv
+	return ses.GetEffectiveDirective(media)
 }
 
+// IsCallHeld reports whether every active media line is held, either by direction or by a null
+// or missing connection address. A call with only some media held is not held: audio held while
+// video stays active, or video inactive with active audio. Use IsMediaHeld for a single line.
 func (ses *Session) IsCallHeld() bool {
-	media := ses.GetAudioMediaFlow()
-	var mode string
-	switch {
-	case media != nil && media.Mode != "":
-		mode = media.Mode
-	case ses.Mode != "":
-		mode = ses.Mode
-	default:
-		mode = SendRecv
-	}
-	if IsMedDirHolding(mode) {
-		return true
-	}
-	if ipv4 := ses.GetEffectiveMediaIPv4(media); ipv4 == "" || ipv4 == "0.0.0.0" {
-		return true
+	active := 0
+	for _, media := range ses.Media {
+		if media.Port == 0 {
+			continue
+		}
+		active++
+		if ses.ClassifyHold(media).IsHeld() || ses.GetEffectiveMediaIPv4(media) == "" {
+			continue
+		}
+		return false
 	}
-	return false
+	return active > 0
 }
 
 // Origin represents an originator of the session.
@@ -637,9 +629,12 @@ type Media struct {
 	Key         []*Key        // Encryption Keys ("k=")
 	Attributes  Attributes    // Attributes ("a=")
 	Mode        string        // Streaming mode ("sendrecv", "recvonly", "sendonly", or "inactive")
-	PTime       string
-	Formats     []*Format // Media Format for RTP/AVP or RTP/SAVP protocols ("rtpmap", "fmtp", "rtcp-fb")
-	FormatDescr string    // Media Format for other protocols
+	PTime       time.Duration // Packet time ("a=ptime")
+	MaxPTime    time.Duration // Maximum packet time ("a=maxptime")
+	Formats     []*Format     // Media Format for RTP/AVP or RTP/SAVP protocols ("rtpmap", "fmtp", "rtcp-fb")
+	FormatDescr string        // Media Format for other protocols
+
+	raw *rawSection
 }
 
 const (
@@ -648,7 +643,8 @@ const (
 	RecvOnly = "recvonly"
 	Inactive = "inactive"
 
-	PTime = "ptime"
+	PTime    = "ptime"
+	MaxPTime = "maxptime"
 
 	Audio       = "audio"       //[RFC8866]
 	Video       = "video"       //[RFC8866]
@@ -732,7 +728,7 @@ func GetSubsequentMediaDirectiveMode(currentLocal string, putCallonHold bool) (o
 			return "", false
 		}
 	}
-	return currentLocal, true
+	return out, true
 }
 
 // NegotiateAnswerMode negotiates streaming mode.
@@ -805,7 +801,9 @@ func (m *Media) clone(prt int) *Media {
 		Information: m.Information,
 		Mode:        newMode,
 		PTime:       m.PTime,
+		MaxPTime:    m.MaxPTime,
 		FormatDescr: m.FormatDescr,
+		raw:         m.raw,
 	}
 
 	// Clone Connection slice for Media
@@ -1133,6 +1131,9 @@ func isRTP(media, proto string) bool {
 }
 
 func asciiToLower(s string) string {
+	if !hasUpper(s) {
+		return s
+	}
 	var b strings.Builder
 	b.Grow(len(s))
 	for i := range len(s) {
@@ -1145,6 +1146,15 @@ func asciiToLower(s string) string {
 	return b.String()
 }
 
+func hasUpper(s string) bool {
+	for i := range len(s) {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
 func asciiToLowerByte(b byte) byte {
 	if 'A' <= b && b <= 'Z' {
 		b += byte(deltaRune)
@@ -3,9 +3,14 @@ package sdp
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseSDP(t *testing.T) {
@@ -889,12 +894,16 @@ a=ptime:20
 			t.Fatalf("failed to parse SDP: %v", err)
 		}
 
-		if ses1.PTime != "40" {
-			t.Errorf("expected 40 found %s", ses1.PTime)
+		if ses1.PTime != 40*time.Millisecond {
+			t.Errorf("expected 40ms found %s", ses1.PTime)
 		}
 
-		if media := ses1.GetAudioMediaFlow(); media.PTime != "20" {
-			t.Errorf("expected 20 found %s", media.PTime)
+		if media := ses1.GetAudioMediaFlow(); media.PTime != 20*time.Millisecond {
+			t.Errorf("expected 20ms found %s", media.PTime)
+		}
+
+		if !strings.Contains(ses1.String(), "\r\na=ptime:40\r\n") {
+			t.Errorf("expected session level ptime to be encoded with its name:\n%s", ses1.String())
 		}
 
 	})
@@ -1411,6 +1420,16 @@ a=sctpmap:5000 webrtc-datachannel 1024
 			_ = ses1.Clone()
 		}
 	})
+
+	b.Run("WithDecodeInto", func(b *testing.B) {
+		b.ReportAllocs()
+		body := []byte(sdpString)
+		ses := new(Session)
+		for b.Loop() {
+			DecodeInto(ses, body)
+		}
+		ses.Release()
+	})
 }
 
 func TestParseWebRTCSDP(t *testing.T) {
@@ -1523,3 +1542,1451 @@ func hashSDPBytes(bytes []byte) string {
 	hash := sha256.Sum256(bytes)
 	return bytesToHexString(hash[:])
 }
+
+func TestMapPayloadTypes(t *testing.T) {
+	legA, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 111 63 0 18 110
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+a=rtpmap:63 red/48000/2
+a=fmtp:63 111/111
+a=rtpmap:18 G729/8000
+a=fmtp:18 annexb=no
+a=rtpmap:110 telephone-event/48000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	legB, _, err := ParseString(`v=0
+o=- 2 1 IN IP4 192.0.2.2
+s=-
+c=IN IP4 192.0.2.2
+t=0 0
+m=audio 5000 RTP/AVP 107 100 0 18 101
+a=rtpmap:107 opus/48000/2
+a=rtpmap:100 red/48000/2
+a=fmtp:100 107/107
+a=rtpmap:0 PCMU/8000
+a=rtpmap:18 G729/8000
+a=rtpmap:101 telephone-event/8000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	maps, err := MapPayloadTypes(legA, legB)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	pm := maps[0]
+
+	for a, b := range map[uint8]uint8{111: 107, 63: 100, 0: 0} {
+		if pm.AtoB[a] != b || pm.BtoA[b] != a {
+			t.Errorf("expected %d <-> %d, got %d / %d", a, b, pm.AtoB[a], pm.BtoA[b])
+		}
+	}
+	if len(pm.UnmatchedA) != 2 || len(pm.UnmatchedB) != 2 {
+		t.Fatalf("expected 2 unmatched formats on each leg, got %d and %d", len(pm.UnmatchedA), len(pm.UnmatchedB))
+	}
+
+	if err := legA.RewritePayloads(maps, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mf := legA.GetAudioMediaFlow()
+	if mf.FormatByPayload(107) == nil || mf.FormatByPayload(111) != nil {
+		t.Errorf("expected opus to be rewritten to 107")
+	}
+	if red := mf.FormatByPayload(100); red == nil || red.Params[0] != "107/107" {
+		t.Errorf("expected RED references to be rewritten, got %v", red)
+	}
+	if !strings.Contains(legA.String(), "a=fmtp:107 minptime=10;useinbandfec=1") {
+		t.Errorf("expected fmtp to follow rewritten payload type:\n%s", legA.String())
+	}
+
+	t.Run("Collision", func(t *testing.T) {
+		m, _, err := ParseString("v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\n"+
+			"m=audio 4000 RTP/AVP 96 97\r\na=rtpmap:96 opus/48000/2\r\na=rtpmap:97 telephone-event/48000\r\n", false)
+		if err != nil {
+			t.Fatalf("failed to parse SDP: %v", err)
+		}
+		mapping := map[uint8]uint8{96: 97}
+		if err := m.Media[0].RewritePayloads(mapping); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := strings.Join(m.Media[0].FormatNames(), ","); got != "opus,telephone-event" {
+			t.Errorf("unexpected formats %s", got)
+		}
+		if opus, dtmf := m.Media[0].Formats[0], m.Media[0].Formats[1]; opus.Payload != 97 || dtmf.Payload != 96 {
+			t.Errorf("expected opus 97 and telephone-event moved to 96, got %d and %d", opus.Payload, dtmf.Payload)
+		}
+		if len(mapping) != 1 {
+			t.Errorf("expected mapping to be left unchanged, got %v", mapping)
+		}
+	})
+}
+
+func TestPlanTranscoding(t *testing.T) {
+	offer, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 18 8 101
+a=rtpmap:18 G729/8000
+a=rtpmap:8 PCMA/8000
+a=rtpmap:101 telephone-event/8000
+a=fmtp:101 0-16
+m=video 4002 RTP/AVP 102
+a=rtpmap:102 H264/90000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	t.Run("Passthrough", func(t *testing.T) {
+		legB, _, _ := ParseString(`v=0
+o=- 2 1 IN IP4 192.0.2.2
+s=-
+c=IN IP4 192.0.2.2
+t=0 0
+m=audio 5000 RTP/AVP 0 8 101
+a=rtpmap:101 telephone-event/8000
+m=video 0 RTP/AVP 102
+a=rtpmap:102 H264/90000
+`, false)
+		plans, err := PlanTranscoding(offer, legB, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if p := plans[0]; p.Action != ActionPassthrough || p.From.Name != "PCMA" || p.DTMF != DTMFPassthrough {
+			t.Errorf("unexpected audio plan: %s", p)
+		}
+		if p := plans[1]; p.Action != ActionReject {
+			t.Errorf("unexpected video plan: %s", p)
+		}
+		if NeedsMediaServer(plans) {
+			t.Errorf("expected no media server to be needed")
+		}
+	})
+
+	t.Run("Transcode", func(t *testing.T) {
+		legB, _, _ := ParseString(`v=0
+o=- 2 1 IN IP4 192.0.2.2
+s=-
+c=IN IP4 192.0.2.2
+t=0 0
+m=audio 5000 RTP/AVP 107 9
+a=rtpmap:107 opus/48000/2
+a=rtpmap:9 G722/8000
+`, false)
+		plans, err := PlanTranscoding(offer, legB, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p := plans[0]
+		if p.Action != ActionTranscode || p.From.Name != "PCMA" || p.To.Name != "G722" {
+			t.Errorf("unexpected audio plan: %s", p)
+		}
+		if p.DTMF != DTMFToInband {
+			t.Errorf("expected RFC 4733 to in-band interworking, got %s", p.DTMF)
+		}
+		if !NeedsMediaServer(plans) {
+			t.Errorf("expected media server to be needed")
+		}
+	})
+}
+
+func TestCodecPolicy(t *testing.T) {
+	policy, err := LoadCodecPolicy([]byte(`{
+		"deny": ["G729"],
+		"weights": {"PCMA": 10, "opus": 5},
+		"mandatory": "PCMU",
+		"maxChannels": 1,
+		"media": {"video": {"allow": ["H264"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	sdpString := `v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 18 107 8 101
+a=rtpmap:18 G729/8000
+a=rtpmap:107 opus/48000/2
+a=rtpmap:8 PCMA/8000
+a=rtpmap:101 telephone-event/8000
+m=video 4002 RTP/AVP 98
+a=rtpmap:98 VP8/90000
+`
+
+	t.Run("Offer", func(t *testing.T) {
+		ses, _, _ := ParseString(sdpString, false)
+		if err := policy.ApplyOffer(ses); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		names := strings.Join(ses.GetAudioMediaFlow().FormatNames(), ",")
+		if names != "PCMA,PCMU,telephone-event" {
+			t.Errorf("unexpected audio formats %s", names)
+		}
+		if video := ses.GetMediaFlow(Video); video.Port != 0 || len(video.Formats) != 1 {
+			t.Errorf("expected video to be disabled keeping a format, got %+v", video)
+		}
+	})
+
+	t.Run("Audio Only", func(t *testing.T) {
+		ses, _, _ := ParseString(sdpString, false)
+		p := &CodecPolicy{Allow: []string{"PCMU", "PCMA"}, MaxClockRate: 8000}
+		if err := p.ApplyOffer(ses); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if video := ses.GetMediaFlow(Video); video.Port != 4002 || len(video.Formats) != 1 {
+			t.Errorf("expected top level rules to leave video as is, got %+v", video)
+		}
+	})
+
+	t.Run("Answer", func(t *testing.T) {
+		ses, _, _ := ParseString(sdpString, false)
+		if err := policy.ApplyAnswer(ses); err == nil {
+			t.Errorf("expected missing mandatory codec error")
+		}
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		p := *policy
+		pcma := &Format{Payload: PCMA}
+		if !p.Permits(pcma) {
+			t.Fatalf("expected PCMA to be permitted")
+		}
+		p.Deny = []string{"pcma"}
+		if p.Permits(pcma) {
+			t.Errorf("expected PCMA to be denied after changing the policy")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := LoadCodecPolicy([]byte(`{"deny": ["PCMU"], "mandatory": "pcmu"}`)); err == nil {
+			t.Errorf("expected error for denied mandatory codec")
+		}
+	})
+}
+
+func TestNegotiatePTime(t *testing.T) {
+	ses, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+a=maxptime:40
+m=audio 4000 RTP/AVP 18 4 0
+a=ptime:25
+`, true)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	mf := ses.GetAudioMediaFlow()
+
+	remote := ses.Packetization(mf)
+	if remote.PTime != 25*time.Millisecond || remote.MaxPTime != 40*time.Millisecond {
+		t.Fatalf("unexpected packetization %+v", remote)
+	}
+	if !strings.Contains(ses.String(), "\r\na=maxptime:40\r\n") {
+		t.Errorf("expected session level maxptime to be encoded:\n%s", ses.String())
+	}
+
+	tests := []struct {
+		payload uint8
+		local   Packetization
+		want    time.Duration
+		wantErr bool
+	}{
+		{payload: 18, want: 20 * time.Millisecond},
+		{payload: 0, want: 25 * time.Millisecond},
+		{payload: 4, want: 30 * time.Millisecond},
+		{payload: 4, local: Packetization{MaxPTime: 20 * time.Millisecond}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NegotiatePTime(mf.FormatByPayload(tt.payload), tt.local, remote)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("payload %d: got %s (err %v), want %s", tt.payload, got, err, tt.want)
+		}
+	}
+
+	if got, err := NegotiatePTime(&Format{Payload: GSM}, Packetization{}, remote); err != nil || got != 25*time.Millisecond {
+		t.Errorf("GSM: got %s (err %v), want 25ms", got, err)
+	}
+	opus := &Format{Payload: 111, Name: "opus", ClockRate: 48000, Channels: 2}
+	if !IsValidPTime(opus, 2500*time.Microsecond) || IsValidPTime(opus, 2*time.Millisecond) {
+		t.Errorf("expected opus to accept 2.5ms but not 2ms")
+	}
+	if !IsValidPTime(&Format{Payload: G728}, 7500*time.Microsecond) || IsValidPTime(&Format{Payload: PCMU}, 7500*time.Microsecond) {
+		t.Errorf("expected fractional ptime to be valid for G.728 only")
+	}
+}
+
+func TestDecodeInvalidPTime(t *testing.T) {
+	for _, v := range []string{"20ms", "NaN", "Inf", "-20", "1e300"} {
+		body := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\n" +
+			"m=audio 4000 RTP/AVP 0\r\na=ptime:" + v + "\r\n"
+		ses, _, err := ParseString(body, false)
+		if err != nil {
+			t.Errorf("ptime %s: expected no error, got %v", v, err)
+			continue
+		}
+		mf := ses.GetAudioMediaFlow()
+		if mf.PTime != 0 || mf.Attributes.Get(PTime) != v {
+			t.Errorf("ptime %s: expected plain attribute, got %s and %v", v, mf.PTime, mf.Attributes)
+		}
+		if !strings.Contains(ses.String(), "\r\na=ptime:"+v+"\r\n") {
+			t.Errorf("ptime %s: expected attribute to be encoded:\n%s", v, ses.String())
+		}
+
+		d := NewDecoderString(body)
+		d.Strict = true
+		if _, err := d.Decode(); err != nil || len(d.Violations()) != 1 {
+			t.Errorf("ptime %s: expected one strict mode warning, got %v (err %v)", v, d.Violations(), err)
+		}
+	}
+}
+
+func TestGetRTPTiming(t *testing.T) {
+	tests := []struct {
+		name   string
+		format *Format
+		ptime  time.Duration
+		want   RTPTiming
+	}{
+		{
+			name:   "G722",
+			format: &Format{Payload: G722, Name: "G722", ClockRate: 8000, Channels: 1},
+			ptime:  20 * time.Millisecond,
+			want:   RTPTiming{ClockRate: 8000, SampleRate: 16000, Channels: 1, SamplesPerPacket: 320, TimestampIncrement: 160, PayloadBytes: 160},
+		},
+		{
+			name:   "L16 Stereo",
+			format: &Format{Payload: 10, Name: "L16", ClockRate: 44100, Channels: 2},
+			ptime:  20 * time.Millisecond,
+			want:   RTPTiming{ClockRate: 44100, SampleRate: 44100, Channels: 2, SamplesPerPacket: 882, TimestampIncrement: 882, PayloadBytes: 3528},
+		},
+		{
+			name:   "Opus",
+			format: &Format{Payload: 111, Name: "opus", ClockRate: 48000, Channels: 2},
+			ptime:  20 * time.Millisecond,
+			want:   RTPTiming{ClockRate: 48000, SampleRate: 48000, Channels: 2, SamplesPerPacket: 960, TimestampIncrement: 960},
+		},
+		{
+			name:   "Telephone Event 48k",
+			format: &Format{Payload: 110, Name: "telephone-event", ClockRate: 48000},
+			ptime:  20 * time.Millisecond,
+			want:   RTPTiming{ClockRate: 48000, SampleRate: 48000, Channels: 1, SamplesPerPacket: 960, TimestampIncrement: 960, PayloadBytes: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRTPTiming(tt.format, tt.ptime)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			tt.want.PTime = tt.ptime
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := GetRTPTiming(&Format{Payload: G729, Name: "G729", ClockRate: 8000}, 15*time.Millisecond); err == nil {
+		t.Errorf("expected error for G.729 with 15ms ptime")
+	}
+}
+
+func TestBandwidthCalculation(t *testing.T) {
+	pcma := &Format{Payload: PCMA, Name: "PCMA", ClockRate: 8000, Channels: 1}
+
+	t.Run("PCMA IPv4", func(t *testing.T) {
+		bws, err := BuildBandwidth(pcma, 20*time.Millisecond, FlowOverhead{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := map[string]int{BandwidthAS: 80, BandwidthTIAS: 64000, BandwidthRS: 1000, BandwidthRR: 3000}
+		for _, bw := range bws {
+			if want[bw.Type] != bw.Value {
+				t.Errorf("expected b=%s:%d, got %d", bw.Type, want[bw.Type], bw.Value)
+			}
+		}
+	})
+
+	t.Run("PCMA IPv6 SRTP", func(t *testing.T) {
+		fb, err := CalculateBitrate(pcma, 20*time.Millisecond, FlowOverhead{IPv6: true, SRTPAuthTag: SRTPAuthTag80})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if fb.IPBitrate != 64000+50*(40+8+12+10)*8 {
+			t.Errorf("unexpected IP bitrate %d", fb.IPBitrate)
+		}
+	})
+
+	t.Run("Best Format Within Budget", func(t *testing.T) {
+		ses, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+b=AS:64
+t=0 0
+m=audio 4000 RTP/AVP 8 18 101
+a=rtpmap:101 telephone-event/8000
+`, true)
+		if err != nil {
+			t.Fatalf("failed to parse SDP: %v", err)
+		}
+		f, err := ses.BestFormatWithinBandwidth(ses.GetAudioMediaFlow(), FlowOverhead{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if f.Payload != G729 {
+			t.Errorf("expected G729 to fit 64 kbps, got %s", f.Name)
+		}
+	})
+}
+
+func TestBandwidthModifiers(t *testing.T) {
+	ses, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+b=CT:100
+t=0 0
+m=audio 4000 RTP/AVP 8
+b=AS:80
+b=RS:1000
+b=RR:3000
+m=video 4002 RTP/AVP 102
+b=AS:2000
+b=TIAS:1900000
+a=rtpmap:102 H264/90000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	if bw, typ := ses.EffectiveBandwidth(ses.GetAudioMediaFlow()); bw != 80000 || typ != BandwidthAS {
+		t.Errorf("expected audio bandwidth AS 80000 bps, got %s %d", typ, bw)
+	}
+	if bw, typ := ses.EffectiveBandwidth(ses.GetMediaFlow(Video)); bw != 100000 || typ != BandwidthCT {
+		t.Errorf("expected video bandwidth capped by CT to 100000 bps, got %s %d", typ, bw)
+	}
+	tias := ses.Clone()
+	tias.Bandwidth, tias.Media[1].Bandwidth = nil, tias.Media[1].Bandwidth[1:]
+	if bw, typ := tias.EffectiveBandwidth(tias.Media[1]); bw != 1900000 || typ != BandwidthTIAS {
+		t.Errorf("expected video bandwidth TIAS 1900000 bps, got %s %d", typ, bw)
+	}
+	if bw, typ := ses.EffectiveBandwidth(nil); bw != 0 || typ != "" {
+		t.Errorf("expected no bandwidth for nil media, got %s %d", typ, bw)
+	}
+	if f, err := ses.BestFormatWithinBandwidth(nil, FlowOverhead{}); f != nil || err == nil {
+		t.Errorf("expected error for nil media, got %v", f)
+	}
+
+	if err := (&Bandwidth{Type: BandwidthTIAS, Value: 64}).Validate(); err == nil {
+		t.Errorf("expected TIAS in kbps to be rejected")
+	}
+	if err := (&Bandwidth{Type: "XY", Value: 64}).Validate(); err == nil {
+		t.Errorf("expected unknown modifier to be rejected")
+	}
+	if err := (&Bandwidth{Type: "X-YZ", Value: 64}).Validate(); err != nil {
+		t.Errorf("expected extension modifier to be accepted, got %v", err)
+	}
+
+	ses.CapBandwidth(40)
+	audio := ses.GetAudioMediaFlow()
+	if as, _ := GetBandwidth(audio.Bandwidth, BandwidthAS); as != 40 {
+		t.Errorf("expected audio AS capped to 40, got %d", as)
+	}
+	if rr, _ := GetBandwidth(audio.Bandwidth, BandwidthRR); rr != 1500 {
+		t.Errorf("expected audio RR scaled to 1500, got %d", rr)
+	}
+	if tias, _ := GetBandwidth(ses.GetMediaFlow(Video).Bandwidth, BandwidthTIAS); tias != 40000 {
+		t.Errorf("expected video TIAS capped to 40000, got %d", tias)
+	}
+}
+
+func TestT38Negotiation(t *testing.T) {
+	ses, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=image 4000 UDP/TLS/UDPTL t38
+a=T38FaxVersion:3
+a=T38MaxBitRate:33600
+a=T38FaxFillBitRemoval
+a=T38FaxTranscodingMMR:1
+a=T38FaxRateManagement:transferredTCF
+a=T38FaxMaxBuffer:2000
+a=T38FaxMaxDatagram:1400
+a=T38FaxUdpEC:t38UDPFEC
+a=setup:actpass
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	if !ses.IsT38Image() {
+		t.Fatalf("expected UDP/TLS/UDPTL media to be detected as T.38")
+	}
+
+	mf := ses.GetT38MediaFlow()
+	offer, err := mf.T38Params()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := T38Params{Version: 3, MaxBitRate: 33600, RateManagement: T38TransferredTCF, MaxBuffer: 2000,
+		MaxDatagram: 1400, UdpEC: T38UDPFEC, FillBitRemoval: true, TranscodingMMR: true}
+	if *offer != want {
+		t.Fatalf("got %+v, want %+v", *offer, want)
+	}
+
+	local := &T38Params{Version: 0, MaxBitRate: 14400, MaxDatagram: 320, UdpEC: T38UDPRedundancy}
+	if err := mf.NegotiateT38(local); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	answer, _ := mf.T38Params()
+	want = T38Params{Version: 0, MaxBitRate: 14400, RateManagement: T38TransferredTCF, MaxBuffer: 2000,
+		MaxDatagram: 320, UdpEC: T38UDPRedundancy}
+	if *answer != want {
+		t.Errorf("got %+v, want %+v", *answer, want)
+	}
+	if !mf.Attributes.Has("setup") {
+		t.Errorf("expected non T.38 attributes to be kept")
+	}
+}
+
+func TestT38SwitchoverReOffers(t *testing.T) {
+	ses, _, err := ParseString(`v=0
+o=- 1 5 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 18 8 101
+a=rtpmap:101 telephone-event/8000
+a=sendrecv
+`, true)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	alloc := func(medType string) (string, int, error) { return "192.0.2.10", 6000, nil }
+
+	t38, err := ses.BuildT38ReOffer(&T38Params{Version: 0, MaxBitRate: 14400, RateManagement: T38TransferredTCF, UdpEC: T38UDPRedundancy}, alloc)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if t38.Origin.SessionVersion != 6 || ses.Origin.SessionVersion != 5 {
+		t.Errorf("expected re-offer version 6 and original untouched, got %d and %d", t38.Origin.SessionVersion, ses.Origin.SessionVersion)
+	}
+	if !t38.IsT38Image() || len(t38.Media) != 1 {
+		t.Fatalf("expected a single T.38 line:\n%s", t38)
+	}
+	if skt := t38.GetEffectiveMediaSocket(t38.Media[0]); skt != "192.0.2.10:6000" {
+		t.Errorf("expected allocated socket, got %s", skt)
+	}
+
+	g711, err := t38.BuildG711FallbackReOffer(alloc)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mf := g711.GetAudioMediaFlow()
+	if names := strings.Join(mf.FormatNames(), ","); names != "PCMU,PCMA" {
+		t.Errorf("expected pinned G.711 formats, got %s", names)
+	}
+	if mf.Attributes.Get(SilenceSupp) != "off - - - -" {
+		t.Errorf("expected silence suppression off:\n%s", g711)
+	}
+	if g711.Origin.SessionVersion != 7 {
+		t.Errorf("expected version 7, got %d", g711.Origin.SessionVersion)
+	}
+}
+
+func TestHoldResume(t *testing.T) {
+	if out, ok := GetSubsequentMediaDirectiveMode(SendRecv, true); !ok || out != SendOnly {
+		t.Errorf("expected sendonly on hold, got %q", out)
+	}
+	if out, ok := GetSubsequentMediaDirectiveMode(Inactive, false); !ok || out != RecvOnly {
+		t.Errorf("expected recvonly on resume from inactive, got %q", out)
+	}
+
+	ses, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 0
+m=video 4002 RTP/AVP 102
+a=rtpmap:102 H264/90000
+a=recvonly
+m=video 0 RTP/AVP 102
+a=rtpmap:102 H264/90000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	held, err := ses.Hold(false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if held.Media[0].Mode != SendOnly || held.Media[1].Mode != Inactive || held.Media[2].Mode != "" {
+		t.Errorf("unexpected hold modes %q %q %q", held.Media[0].Mode, held.Media[1].Mode, held.Media[2].Mode)
+	}
+	if held.Origin.SessionVersion != 2 || held.Connection.Address != "192.0.2.1" {
+		t.Errorf("expected version bump without null address:\n%s", held)
+	}
+	want := []HoldState{HoldStateSendOnly, HoldStateInactive, HoldStateDisabled}
+	if got := held.HoldStates(); !slices.Equal(got, want) {
+		t.Errorf("got hold states %v, want %v", got, want)
+	}
+
+	legacy, _ := ses.Hold(true)
+	if state := legacy.ClassifyHold(legacy.Media[0]); state != HoldStateLegacyHold {
+		t.Errorf("expected legacy hold, got %s", state)
+	}
+	if _, err := legacy.Resume(""); err == nil {
+		t.Errorf("expected error when resuming legacy hold without address")
+	}
+
+	resumed, err := held.Resume("")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resumed.Media[0].Mode != SendRecv || resumed.Media[1].Mode != RecvOnly {
+		t.Errorf("unexpected resume modes %q %q", resumed.Media[0].Mode, resumed.Media[1].Mode)
+	}
+}
+
+func TestPerMediaHoldDetection(t *testing.T) {
+	offer, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+a=sendonly
+m=audio 4000 RTP/AVP 0
+a=sendrecv
+m=video 4002 RTP/AVP 102
+a=rtpmap:102 H264/90000
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	if mode := offer.GetEffectiveDirective(offer.Media[1]); mode != SendOnly {
+		t.Errorf("expected video to inherit session sendonly, got %s", mode)
+	}
+	if summary := offer.HoldSummary(); summary != "audio active, video held" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	if offer.IsCallHeld() {
+		t.Errorf("expected call with active audio not to be held")
+	}
+	audioHeld := offer.Clone()
+	audioHeld.Media[0].Mode, audioHeld.Media[1].Mode = SendOnly, SendRecv
+	if audioHeld.IsCallHeld() || !audioHeld.IsMediaHeld(audioHeld.Media[0]) {
+		t.Errorf("expected call with held audio and active video not to be held")
+	}
+	audioHeld.Media[1].Mode = Inactive
+	if !audioHeld.IsCallHeld() {
+		t.Errorf("expected call with every line held to be held")
+	}
+
+	answer, _, err := ParseString(`v=0
+o=- 2 1 IN IP4 192.0.2.2
+s=-
+c=IN IP4 192.0.2.2
+t=0 0
+m=audio 5000 RTP/AVP 0
+a=recvonly
+m=video 5002 RTP/AVP 102
+a=rtpmap:102 H264/90000
+a=sendonly
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	got, err := CompareDirections(offer, answer)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []DirectionAsymmetry{DirectionNarrowed, DirectionInvalid}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestClassifyReOffer(t *testing.T) {
+	base := `v=0
+o=- 1 %d IN IP4 192.0.2.1
+s=-
+c=IN IP4 %s
+t=0 0
+m=audio %d RTP/AVP %s
+a=ice-ufrag:%s
+a=%s
+`
+	parse := func(ver int, addr string, port int, fmts, ufrag, mode string) *Session {
+		ses, _, err := ParseString(fmt.Sprintf(base, ver, addr, port, fmts, ufrag, mode), true)
+		if err != nil {
+			t.Fatalf("failed to parse SDP: %v", err)
+		}
+		return ses
+	}
+	prev := parse(1, "192.0.2.1", 4000, "0 8", "abcd", SendRecv)
+
+	tests := []struct {
+		name string
+		next *Session
+		want ReOfferChange
+	}{
+		{"Refresh", parse(2, "192.0.2.1", 4000, "0 8", "abcd", SendRecv), ChangeNone},
+		{"Hold", parse(2, "192.0.2.1", 4000, "0 8", "abcd", SendOnly), ChangeHold},
+		{"Legacy Hold", parse(2, "0.0.0.0", 4000, "0 8", "abcd", SendRecv), ChangeHold},
+		{"Codec", parse(2, "192.0.2.1", 4000, "8", "abcd", SendRecv), ChangeCodec},
+		{"Address", parse(2, "192.0.2.9", 4002, "0 8", "abcd", SendRecv), ChangeAddress},
+		{"ICE Restart", parse(2, "192.0.2.1", 4000, "0 8", "efgh", SendRecv), ChangeICERestart},
+		{"Stream Removed", parse(2, "192.0.2.1", 0, "0 8", "abcd", SendRecv), ChangeStreamRemoved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyReOffer(prev, tt.next); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	resumed := ClassifyReOffer(parse(2, "192.0.2.1", 4000, "0 8", "abcd", Inactive), prev)
+	if !resumed.Has(ChangeResume) || resumed.TouchesMedia() {
+		t.Errorf("expected resume without media change, got %s", resumed)
+	}
+
+	if got := ClassifyReOffer(nil, prev); got != ChangeStreamAdded {
+		t.Errorf("first offer: got %s, want %s", got, ChangeStreamAdded)
+	}
+	if got := ClassifyReOffer(prev, nil); got != ChangeStreamRemoved {
+		t.Errorf("no description: got %s, want %s", got, ChangeStreamRemoved)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+a=ice-ufrag:abcd
+m=audio 4000 RTP/AVP 0 8
+a=candidate:1 1 UDP 100 192.0.2.1 4000 typ host
+a=candidate:2 1 UDP 90 198.51.100.1 4000 typ srflx
+a=sendrecv
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	b, _, err := ParseString(`v=0
+o=- 1 2 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+a=ICE-UFRAG:efgh
+m=audio 4000 RTP/AVP 0 9
+a=candidate:2 1 UDP 90 198.51.100.1 4000 typ srflx
+a=candidate:1 1 UDP 100 192.0.2.1 4000 typ host
+a=sendrecv
+m=video 0 RTP/AVP 96
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	paths := func(changes []*Change) []string {
+		out := make([]string, len(changes))
+		for i, c := range changes {
+			out[i] = string(c.Kind) + " " + c.Path
+		}
+		return out
+	}
+
+	got := paths(Diff(a, b, IgnoreOriginVersion(), IgnoreCandidateOrder()))
+	want := []string{
+		"modified session.attributes[ice-ufrag]",
+		"removed media[0].formats[pt=8]",
+		"added media[0].formats[pt=9]",
+		"added media[1]",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = paths(Diff(a, a.Clone()))
+	if len(got) != 0 {
+		t.Errorf("expected no changes, got %q", got)
+	}
+
+	changes := Diff(a, b, IgnoreAttributeCase())
+	if got, want := changes[0].Path, "session.origin.sessionVersion"; got != want {
+		t.Errorf("got path %q, want %q", got, want)
+	}
+	if !slices.Contains(paths(changes), "reordered media[0].attributes[candidate]") {
+		t.Errorf("expected candidate reordering, got %q", paths(changes))
+	}
+	if got, want := RenderDiff(changes[:1]), "- session.origin.sessionVersion: 1\n+ session.origin.sessionVersion: 2\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := paths(Diff(nil, b)), []string{"added session"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := paths(Diff(a, nil)), []string{"removed session"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := Diff(nil, nil); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
+
+func TestEqualsWith(t *testing.T) {
+	a, _, err := ParseString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+c=IN IP4 192.0.2.1
+t=0 0
+m=audio 4000 RTP/AVP 0 101
+a=rtpmap:101 telephone-event/8000
+a=fmtp:101 0-15;x=1
+a=ssrc:1111 cname:a
+a=sendrecv
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+	b, _, err := ParseString(`v=0
+o=- 1 2 IN IP4 192.0.2.1
+s=-
+c=IN IP4 198.51.100.1
+t=0 0
+m=audio 5000 RTP/AVP 101 0
+a=rtpmap:101 telephone-event/8000
+a=fmtp:101 x=1; 0-15
+a=ssrc:2222 cname:b
+a=sendrecv
+`, false)
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	if a.EqualsWith(b) || a.Equals(b) {
+		t.Errorf("expected sessions to differ")
+	}
+	if !a.EqualsWith(a.Clone()) {
+		t.Errorf("expected session to equal its clone")
+	}
+	sameMedia := []CompareOption{
+		IgnoreOriginVersion(), IgnorePorts(), IgnoreConnections(),
+		IgnoreFormatOrder(), IgnoreFmtpOrder(), IgnoreAttributes("SSRC"),
+	}
+	if !a.EqualsWith(b, sameMedia...) {
+		t.Errorf("expected same media, got diff:\n%s", RenderDiff(Diff(a, b, sameMedia...)))
+	}
+	if a.EqualsWith(b, sameMedia[:len(sameMedia)-1]...) {
+		t.Errorf("expected ssrc to differ")
+	}
+}
+
+func TestVersionedSession(t *testing.T) {
+	ses, err := NewSessionSDP(1, 5, "192.0.2.1", "-", "1234", SendRecv, 4000, []uint8{PCMU, PCMA})
+	if err != nil {
+		t.Fatalf("failed to build SDP: %v", err)
+	}
+	vs := NewVersionedSession(ses)
+	version := func() int64 {
+		t.Helper()
+		if _, err := vs.Bytes(); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		return vs.Session().Origin.SessionVersion
+	}
+
+	if got := version(); got != 5 {
+		t.Errorf("first encode: got version %d, want 5", got)
+	}
+	if got := version(); got != 5 {
+		t.Errorf("unchanged: got version %d, want 5", got)
+	}
+	ses.SetConnection(Audio, "192.0.2.9", 4002, false, false)
+	if got := vs.String(); !strings.Contains(got, "o=- 1 6 ") {
+		t.Errorf("expected String to show the updated version, got\n%s", got)
+	}
+	if got := version(); got != 6 {
+		t.Errorf("changed: got version %d, want 6", got)
+	}
+	ses.BumpVersion()
+	if got := version(); got != 6 {
+		t.Errorf("manual bump without change: got version %d, want 6", got)
+	}
+	if got := vs.Sent().Origin.SessionVersion; got != 6 {
+		t.Errorf("sent: got version %d, want 6", got)
+	}
+
+	ses.Name = ""
+	if err := vs.Encode(NewEncoderOptions(nil, EncoderOptions{Strict: true})); err == nil {
+		t.Fatalf("expected strict encode to fail")
+	}
+	if got := vs.Sent().Name; got == "" {
+		t.Errorf("expected failed encode not to be remembered as sent")
+	}
+	if got := version(); got != 7 {
+		t.Errorf("changed after failed encode: got version %d, want 7", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := NewDecoderString(`v=0
+o=- 1 1 IN IP4 192.0.2.1
+s=-
+t=0 0
+m=audio 4000 RTP/AVP 0 96 300
+a=sendonly
+a=recvonly
+a=rtpmap:352 PCMA/8000
+a=rtpmap:200 X/8000
+m=video 70000 RTP/AVP 97
+c=IN IP4 192.0.2.1
+a=rtpmap:97 H264/90000
+m=application 4002 RTP/AVP x
+c=IN IP4 192.0.2.1
+`)
+	d.Strict = true
+	_, err := d.Decode()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	type finding struct {
+		line int
+		msg  string
+	}
+	var got []finding
+	for _, v := range verr.Violations {
+		got = append(got, finding{v.Line, v.Message})
+	}
+	want := []finding{
+		{5, "payload type 300 out of range 0-255"},
+		{5, "active audio media without connection"},
+		{5, "dynamic payload type 96 without rtpmap"},
+		{5, "payload type 200 out of range 0-127"},
+		{7, "conflicting direction attributes sendonly and recvonly"},
+		{8, "payload type 352 out of range 0-255"},
+		{10, "port 70000 out of range"},
+		{13, `invalid payload type "x" for RTP/AVP`},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	d = NewDecoderString("o=- 1 1 IN IP4 192.0.2.1\r\nv=0\r\nc=IN IP4 192.0.2.1\r\ns=-\r\n")
+	d.Strict = true
+	if _, err := d.Decode(); err == nil {
+		t.Fatalf("expected validation error")
+	}
+	got = nil
+	for _, v := range d.Violations() {
+		got = append(got, finding{v.Line, v.Message})
+	}
+	want = []finding{
+		{1, "first line must be v=, got o="},
+		{2, "v= line out of order"},
+		{4, "s= line out of order"},
+		{0, "missing t= line"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	ses, err := NewSessionSDP(1, 1, "192.0.2.1", "-", "1234", SendRecv, 4000, []uint8{PCMU})
+	if err != nil {
+		t.Fatalf("failed to build SDP: %v", err)
+	}
+	if v := ses.Validate(); len(v) != 0 {
+		t.Errorf("expected no violations, got %v", v)
+	}
+	ses.Media[0].Formats = append(ses.Media[0].Formats, &Format{Payload: 200})
+	if v := ses.Validate(); !HasErrors(v) {
+		t.Errorf("expected payload type error, got %v", v)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name  string
+		sdp   string
+		line  int
+		field byte
+		kind  DecodeErrorKind
+		is    error
+	}{
+		{"Format", "v=0\r\no=- 1 1 IN IP4\r\n", 2, 'o', DecodeErrorFormat, ErrFormat},
+		{"Unexpected Field", "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\nx=1\r\n", 3, 'x', DecodeErrorUnexpectedField, ErrUnexpectedField},
+		{"Invalid Value", "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\nm=audio x RTP/AVP 0\r\n", 3, 'm', DecodeErrorInvalidValue, strconv.ErrSyntax},
+		{"Payload Type", "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\nm=audio 4000 RTP/AVP 8\r\na=rtpmap:352 PCMA/8000\r\n", 4, 'a', DecodeErrorFormat, ErrFormat},
+		{"Malformed", "v=0\r\nbroken\r\n", 2, 0, DecodeErrorFormat, ErrFormat},
+		{"Line Too Long", "v=0\r\na=" + strings.Repeat("x", 2*maxLineSize) + "\r\n", 2, 0, DecodeErrorLineTooLong, ErrLineTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDecoder(strings.NewReader(tt.sdp)).Decode()
+			var derr *DecodeError
+			if !errors.As(err, &derr) {
+				t.Fatalf("expected *DecodeError, got %v", err)
+			}
+			if derr.Line != tt.line || derr.Field != tt.field || derr.Kind != tt.kind {
+				t.Errorf("got line %d field %q kind %s, want line %d field %q kind %s",
+					derr.Line, derr.Field, derr.Kind, tt.line, tt.field, tt.kind)
+			}
+			if !errors.Is(err, tt.is) {
+				t.Errorf("expected errors.Is(%v, %v)", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestLenientDecode(t *testing.T) {
+	body := "v=0\n" +
+		"o=1 1 IN IP4 192.0.2.1\n" +
+		"s=PBX \n" +
+		"c=IN IP4 192.0.2.1\n" +
+		"c=IN IP4 192.0.2.2\n" +
+		"y=unknown\n" +
+		"m=audio 4000 RTP/AVP 0 8 \n" +
+		"a=sendrecv\n" +
+		"m=video x RTP/AVP 96\n" +
+		"a=rtpmap:96 H264/90000\n"
+
+	if _, _, err := ParseString(body, false); err == nil {
+		t.Fatalf("expected error in default mode")
+	}
+	ses, warnings, err := ParseLenient(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ses.Origin.Username != "-" || ses.Name != "PBX" || ses.Connection.Address != "192.0.2.1" {
+		t.Errorf("unexpected repairs: origin %+v, name %q, connection %+v", ses.Origin, ses.Name, ses.Connection)
+	}
+	if len(ses.Media) != 1 || len(ses.Media[0].Formats) != 2 || ses.Media[0].Mode != SendRecv {
+		t.Errorf("expected one audio media with two formats, got %s", ses)
+	}
+
+	var lines []int
+	for _, w := range warnings {
+		if w.Severity != SeverityWarning {
+			t.Errorf("expected warning, got %s", w)
+		}
+		lines = append(lines, w.Line)
+	}
+	if want := []int{2, 3, 5, 6, 7, 9, 0}; !slices.Equal(lines, want) {
+		t.Errorf("got warnings on lines %v, want %v: %v", lines, want, warnings)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	body := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nt=0 0\r\n" +
+		"m=audio 4000 RTP/AVP 0 8 9\r\n" +
+		"a=candidate:1 1 UDP 100 192.0.2.1 4000 typ host\r\n" +
+		"a=candidate:2 1 UDP 90 192.0.2.1 4002 typ host\r\n" +
+		"m=video 4004 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000\r\n"
+
+	tests := []struct {
+		name  string
+		opts  DecoderOptions
+		limit string
+	}{
+		{"No Limits", DecoderOptions{}, ""},
+		{"Body Size", DecoderOptions{MaxBodySize: 64}, "MaxBodySize"},
+		{"Lines", DecoderOptions{MaxLines: 5}, "MaxLines"},
+		{"Media", DecoderOptions{MaxMedia: 1}, "MaxMedia"},
+		{"Attributes", DecoderOptions{MaxAttributes: 2}, "MaxAttributes"},
+		{"Formats", DecoderOptions{MaxFormats: 2}, "MaxFormats"},
+		{"Candidates", DecoderOptions{MaxCandidates: 1}, "MaxCandidates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoders := []*Decoder{
+				NewDecoderOptions(strings.NewReader(body), tt.opts),
+				NewDecoderStringOptions(body, tt.opts),
+			}
+			for _, d := range decoders {
+				_, err := d.Decode()
+				if tt.limit == "" {
+					if err != nil {
+						t.Errorf("expected no error, got %v", err)
+					}
+					continue
+				}
+				var limitErr *LimitError
+				var decodeErr *DecodeError
+				if !errors.As(err, &limitErr) || !errors.As(err, &decodeErr) {
+					t.Fatalf("expected limit error, got %v", err)
+				}
+				if limitErr.Limit != tt.limit || decodeErr.Kind != DecodeErrorLimit {
+					t.Errorf("got limit %s kind %s, want %s", limitErr.Limit, decodeErr.Kind, tt.limit)
+				}
+			}
+		})
+	}
+
+	d := NewDecoderStringOptions(body, DecoderOptions{MaxLineSize: 16})
+	if _, err := d.Decode(); !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("expected line too long, got %v", err)
+	}
+	long := body + "a=" + strings.Repeat("x", 2*maxLineSize) + "\r\n"
+	if _, err := NewDecoderStringOptions(long, DecoderOptions{}).Decode(); !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("expected default line size limit, got %v", err)
+	}
+	spaced := strings.Replace(body, "RTP/AVP 0 8 9", "RTP/AVP  0  8  9", 1)
+	var limitErr *LimitError
+	if _, err := NewDecoderStringOptions(spaced, DecoderOptions{MaxFormats: 3}).Decode(); errors.As(err, &limitErr) {
+		t.Errorf("expected repeated spaces not to count as formats, got %v", err)
+	}
+}
+
+func TestPreserveRoundTrip(t *testing.T) {
+	body := "v=0\r\n" +
+		"o=- 1 1 IN IP4 192.0.2.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"a=ptime:20\r\n" +
+		"c=IN IP4 192.0.2.1\r\n" +
+		"m=audio 4000 RTP/AVP 0 101\r\n" +
+		"a=sendrecv\r\n" +
+		"a=fmtp:101 0-15\r\n" +
+		"a=X-Custom:Value\r\n" +
+		"a=rtpmap:101 telephone-event/8000\r\n" +
+		"a=PTIME:20.0\n" +
+		"m=video 0 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000"
+
+	decoders := []struct {
+		name string
+		new  func() *Decoder
+	}{
+		{"String", func() *Decoder { return NewDecoderString(body) }},
+		{"Reader", func() *Decoder { return NewDecoder(strings.NewReader(body)) }},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(ses *Session)
+		want   string
+	}{
+		{
+			name:   "Unmodified",
+			modify: func(ses *Session) {},
+			want:   body,
+		},
+		{
+			name: "Modified",
+			modify: func(ses *Session) {
+				ses.BumpVersion()
+				ses.Media[0].Port = 5000
+				ses.Media[0].Mode = SendOnly
+				ses.Media[0].Attributes = append(ses.Media[0].Attributes, NewAttr("ssrc", "1234"))
+			},
+			want: strings.NewReplacer(
+				"o=- 1 1", "o=- 1 2",
+				"m=audio 4000", "m=audio 5000",
+				"a=sendrecv", "a=sendonly",
+				"a=PTIME:20.0\n", "a=PTIME:20.0\na=ssrc:1234\r\n",
+			).Replace(body),
+		},
+		{
+			name: "ModifiedLastLine",
+			modify: func(ses *Session) {
+				ses.Media[1].PTime = 20 * time.Millisecond
+			},
+			want: body + "\r\na=ptime:20\r\n",
+		},
+		{
+			name: "AppendedMedia",
+			modify: func(ses *Session) {
+				ses.Media = append(ses.Media, &Media{Type: "audio", Port: 6000, Proto: "RTP/AVP", Formats: []*Format{{Payload: 8}}})
+			},
+			want: body + "\r\nm=audio 6000 RTP/AVP 8\r\n",
+		},
+	}
+
+	for _, dec := range decoders {
+		for _, tt := range tests {
+			t.Run(dec.name+"/"+tt.name, func(t *testing.T) {
+				d := dec.new()
+				d.Preserve = true
+				ses, err := d.Decode()
+				if err != nil {
+					t.Fatalf("failed to parse SDP: %v", err)
+				}
+				if !ses.Raw() || ses.Clone().String() != body {
+					t.Fatalf("expected clone to keep received lines")
+				}
+				tt.modify(ses)
+				if got := ses.String(); got != tt.want {
+					t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+				}
+				if got := ses.DropRaw().String(); got == tt.want || !strings.HasPrefix(got, "v=0\r\no=- 1 ") {
+					t.Errorf("expected canonical encoding, got %q", got)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	bodies := []string{
+		"v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\na=group:BUNDLE 0\r\n" +
+			"m=audio 4000 RTP/AVP 0 96\r\na=rtpmap:96 opus/48000/2\r\na=fmtp:96 useinbandfec=1\r\na=mid:0\r\na=sendrecv\r\n",
+		"v=0\r\no=- 2 2 IN IP4 192.0.2.2\r\ns=-\r\nt=0 0\r\n" +
+			"m=video 5000 RTP/AVP 97\r\nc=IN IP4 192.0.2.2\r\na=rtpmap:97 H264/90000\r\na=rtcp-fb:97 nack\r\n",
+	}
+	ses := new(Session)
+	for i, body := range bodies {
+		if err := DecodeInto(ses, []byte(body)); err != nil {
+			t.Fatalf("body %d: failed to decode: %v", i, err)
+		}
+		want, _, err := ParseString(body, false)
+		if err != nil {
+			t.Fatalf("body %d: failed to parse: %v", i, err)
+		}
+		if !ses.EqualsWith(want) {
+			t.Errorf("body %d: got diff:\n%s", i, RenderDiff(Diff(want, ses)))
+		}
+	}
+
+	if err := DecodeInto(ses, []byte("v=0\r\nbroken\r\n")); err == nil {
+		t.Errorf("expected decode error")
+	}
+	ses.Release()
+	if ses.Origin != nil || len(ses.Media) != 0 || len(ses.Attributes) != 0 {
+		t.Errorf("expected empty session after release, got %+v", ses)
+	}
+
+	b := []byte("v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\ne=a@example.com\r\np=+1 555\r\nt=0 0\r\n")
+	if err := DecodeInto(ses, b); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	ses.Release()
+	if slices.ContainsFunc(ses.Email[:cap(ses.Email)], func(s string) bool { return s != "" }) ||
+		slices.ContainsFunc(ses.Phone[:cap(ses.Phone)], func(s string) bool { return s != "" }) {
+		t.Errorf("expected released email and phone to keep no strings of the buffer")
+	}
+	d := &Decoder{pool: true, p: []string{"x"}, last: "y", lastEOL: "\r\n"}
+	d.release()
+	if d.p[:cap(d.p)][0] != "" || d.last != "" || d.lastEOL != "" {
+		t.Errorf("expected released decoder to keep no strings of the buffer")
+	}
+}
+
+func TestPartialDecode(t *testing.T) {
+	body := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\na=group:BUNDLE 0\r\n" +
+		"a=sendonly\r\na=ptime:30\r\n" +
+		"m=audio 4000 RTP/AVP 0 96\r\na=rtpmap:96 opus/48000/2\r\na=mid:0\r\n" +
+		"m=video 0 RTP/AVP 97\r\n" +
+		"m=image 4002 udptl t38\r\nc=IN IP4 198.51.100.1\r\na=T38FaxVersion:0\r\n"
+
+	ps, err := DecodePartial(body)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if ps.Origin.SessionID != 1 || ps.Connection.Address != "192.0.2.1" || len(ps.Media) != 3 {
+		t.Fatalf("unexpected partial session %+v", ps)
+	}
+	if m := ps.Media[2]; m.Type != Image || m.Port != 4002 || len(m.Connection) != 1 || m.media != nil {
+		t.Errorf("unexpected image media %+v", m)
+	}
+	attrs, err := ps.Media[0].Attributes()
+	if err != nil || attrs.Get("mid") != "0" {
+		t.Errorf("got attributes %v, error %v", attrs, err)
+	}
+	if media, _ := ps.Media[0].Media(); media.FormatByPayload(96) == nil {
+		t.Errorf("expected opus format, got %+v", media.Formats)
+	}
+	if attrs, _ := ps.Attributes(); attrs.Get("group") != "BUNDLE 0" {
+		t.Errorf("got session attributes %v", attrs)
+	}
+	if mode, err := ps.Mode(); err != nil || mode != SendOnly {
+		t.Errorf("got session mode %q, error %v", mode, err)
+	}
+	if p, err := ps.Packetization(); err != nil || p.PTime != 30*time.Millisecond {
+		t.Errorf("got session packetization %+v, error %v", p, err)
+	}
+	if ses, err := ps.Session(); err != nil || len(ses.Media) != 3 {
+		t.Errorf("failed to decode full session: %v", err)
+	}
+
+	bad, err := DecodePartial(strings.Replace(body, "opus/48000/2", "opus/x", 1))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	var derr *DecodeError
+	if _, err := bad.Media[0].Media(); !errors.As(err, &derr) || derr.Line != 10 {
+		t.Errorf("expected decode error on line 10, got %v", err)
+	}
+
+	sc := Scanner(body)
+	if sc.HasVideo() || !sc.HasMedia(Audio) || !sc.IsT38() {
+		t.Errorf("got video %v, audio %v, T.38 %v", sc.HasVideo(), sc.HasMedia(Audio), sc.IsT38())
+	}
+	if got, want := sc.AudioSocket(), "192.0.2.1:4000"; got != want {
+		t.Errorf("got audio socket %q, want %q", got, want)
+	}
+	if got, want := sc.MediaSocket(Image), "198.51.100.1:4002"; got != want {
+		t.Errorf("got image socket %q, want %q", got, want)
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	ses, err := NewSessionSDP(1, 1, "192.0.2.1", "-", "1234", SendRecv, 4000, []uint8{PCMU})
+	if err != nil {
+		t.Fatalf("failed to build SDP: %v", err)
+	}
+	metadata := &BodyPart{ContentType: "application/rs-metadata+xml", Disposition: "recording-session", Body: []byte("<recording/>")}
+	contentType, body, err := ses.BuildMultipart("mixed", metadata)
+	if err != nil {
+		t.Fatalf("failed to build multipart body: %v", err)
+	}
+	if !strings.HasPrefix(contentType, "multipart/mixed; boundary=") {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+	if !strings.Contains(string(body), "Content-Disposition: session") {
+		t.Errorf("expected session disposition, got\n%s", body)
+	}
+
+	got, _, err := ParseBody(contentType, body, false)
+	if err != nil {
+		t.Fatalf("failed to parse multipart body: %v", err)
+	}
+	if !got.Equals(ses) {
+		t.Errorf("got\n%s\nwant\n%s", got, ses)
+	}
+
+	nested := "--outer\r\nContent-Type: application/pidf+xml\r\n\r\n<presence/>\r\n" +
+		"--outer\r\nContent-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+		"--inner\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--inner\r\nContent-Type: application/sdp\r\n\r\n" + ses.String() + "\r\n--inner--\r\n" +
+		"\r\n--outer--\r\n"
+	sdp, err := ExtractSDP(`multipart/mixed; boundary="outer"`, []byte(nested))
+	if err != nil || string(sdp) != ses.String() {
+		t.Errorf("got %q, error %v", sdp, err)
+	}
+	if _, err := ExtractSDP("multipart/mixed; boundary=outer", []byte("--outer\r\nContent-Type: text/plain\r\n\r\nx\r\n--outer--\r\n")); err == nil {
+		t.Errorf("expected error for body without SDP")
+	}
+	if sdp, err := ExtractSDP(ContentType, []byte("v=0")); err != nil || string(sdp) != "v=0" {
+		t.Errorf("got %q, error %v", sdp, err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	first := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=first\r\nt=0 0\r\nm=audio 4000 RTP/AVP 0\r\n"
+	second := "v=0\no=- 2 1 IN IP4 192.0.2.2\ns=second\nt=0 0\n"
+	third := "v=0\r\no=- 3 1 IN IP4 192.0.2.3\r\ns=third\r\nt=0 0\r\n"
+	stream := first + second + "\r\n\r\n" + third
+
+	all, err := DecodeAll(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	wantOffsets := []int64{0, int64(len(first)), int64(len(first) + len(second) + 4)}
+	wantNames := []string{"first", "second", "third"}
+	if len(all) != len(wantNames) {
+		t.Fatalf("got %d sessions, want %d", len(all), len(wantNames))
+	}
+	for i, ds := range all {
+		if ds.Session.Name != wantNames[i] || ds.Offset != wantOffsets[i] {
+			t.Errorf("session %d: got %q at %d, want %q at %d", i, ds.Session.Name, ds.Offset, wantNames[i], wantOffsets[i])
+		}
+		if got := stream[ds.Offset:][:3]; got != "v=0" {
+			t.Errorf("session %d: offset points to %q", i, got)
+		}
+	}
+	if len(all[0].Session.Media) != 1 {
+		t.Errorf("expected first session to keep its media")
+	}
+
+	d := NewDecoderString(first + "v=0\r\ns=truncated\r\n")
+	n := 0
+	for _, err := range d.All() {
+		if err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("expected unexpected EOF, got %v", err)
+			}
+			break
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d sessions before the error, want 1", n)
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	body := "v=0\r\n" +
+		"o=- 1 1 IN IP4 192.0.2.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 192.0.2.1\r\n" +
+		"t=0 0\r\n" +
+		"m=video 4000 RTP/AVP 96\r\n" +
+		"a=sendrecv\r\n" +
+		"a=ssrc:1 cname:x\r\n" +
+		"a=mid:0\r\n" +
+		"a=rtpmap:96 VP8/90000\r\n" +
+		"a=rtcp-fb:96 nack\r\n" +
+		"a=fmtp:96 max-fr=30\r\n" +
+		"a=ssrc:1 msid:y\r\n"
+	d := NewDecoderString(body)
+	d.Preserve = true
+	ses, err := d.Decode()
+	if err != nil {
+		t.Fatalf("failed to parse SDP: %v", err)
+	}
+
+	e := NewEncoderOptions(nil, EncoderOptions{LF: true, Canonical: true})
+	if err := e.Encode(ses); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	want := "v=0\no=- 1 1 IN IP4 192.0.2.1\ns=-\nc=IN IP4 192.0.2.1\nt=0 0\n" +
+		"m=video 4000 RTP/AVP 96\n" +
+		"a=rtpmap:96 VP8/90000\na=fmtp:96 max-fr=30\na=rtcp-fb:96 nack\n" +
+		"a=sendrecv\na=mid:0\na=ssrc:1 cname:x\na=ssrc:1 msid:y\n"
+	if got := e.String(); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+
+	prefix := []byte("INVITE body:\n")
+	b, err := e.AppendTo(prefix, ses)
+	if err != nil || string(b) != string(prefix)+want {
+		t.Errorf("got %q, error %v", b, err)
+	}
+	if got := string(ses.AppendTo(nil)); got != body {
+		t.Errorf("expected received lines, got %q", got)
+	}
+
+	strict := NewEncoderOptions(nil, EncoderOptions{Strict: true})
+	if err := strict.Encode(ses); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	ses.Media[0].Connection = []*Connection{{Network: NetworkInternet, Type: TypeIPv4}}
+	if err := strict.Encode(ses); err == nil || len(strict.Bytes()) != 0 {
+		t.Errorf("expected error for connection without address, got %v", err)
+	}
+	if got := ses.DropRaw().String(); !strings.Contains(got, "c=IN IP4 127.0.0.1") {
+		t.Errorf("expected default address without strict mode, got %q", got)
+	}
+}
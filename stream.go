@@ -0,0 +1,67 @@
+package sdp
+
+import (
+	"io"
+	"iter"
+)
+
+// DecodedSession is a session description read from a stream of concatenated descriptions.
+type DecodedSession struct {
+	Session *Session
+	Offset  int64 // byte offset of the v= line in the stream
+}
+
+// DecodeNext decodes the next session description of a stream of concatenated descriptions, as found
+// in SAP caches or RTSP archives. A description ends at the next v= line, a blank line or the end of
+// the stream. It returns io.EOF when no description is left.
+func (d *Decoder) DecodeNext() (*DecodedSession, error) {
+	d.multi = true
+	ses, err := d.decode(new(Session))
+	if err != nil {
+		return nil, err
+	}
+	return &DecodedSession{Session: ses, Offset: d.start}, nil
+}
+
+// All iterates over the session descriptions of the stream, stopping after the first error.
+func (d *Decoder) All() iter.Seq2[*DecodedSession, error] {
+	return func(yield func(*DecodedSession, error) bool) {
+		for {
+			ds, err := d.DecodeNext()
+			if err == io.EOF {
+				return
+			}
+			if !yield(ds, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// DecodeAll decodes every session description of r.
+func DecodeAll(r io.Reader) ([]*DecodedSession, error) {
+	var all []*DecodedSession
+	for ds, err := range NewDecoder(r).All() {
+		if err != nil {
+			return all, err
+		}
+		all = append(all, ds)
+	}
+	return all, nil
+}
+
+// readLine reads the next line, or the line given back by the previous description, and tracks offsets.
+func (d *Decoder) readLine() (string, error) {
+	if d.unread {
+		d.unread = false
+		return d.last, nil
+	}
+	s, err := d.r.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	d.last, d.lastEOL = s, d.r.EOL()
+	d.lineStart = d.pos
+	d.pos += int64(len(s) + len(d.lastEOL))
+	return s, nil
+}
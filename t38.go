@@ -0,0 +1,211 @@
+package sdp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// T.38 attributes (ITU-T T.38 Annex D, RFC 7345).
+const (
+	T38FaxVersion            = "T38FaxVersion"
+	T38MaxBitRate            = "T38MaxBitRate"
+	T38FaxRateManagement     = "T38FaxRateManagement"
+	T38FaxMaxBuffer          = "T38FaxMaxBuffer"
+	T38FaxMaxDatagram        = "T38FaxMaxDatagram"
+	T38FaxUdpEC              = "T38FaxUdpEC"
+	T38FaxFillBitRemoval     = "T38FaxFillBitRemoval"
+	T38FaxTranscodingMMR     = "T38FaxTranscodingMMR"
+	T38FaxTranscodingJBIG    = "T38FaxTranscodingJBIG"
+	T38FormatDescr           = "t38"
+	T38LocalTCF              = "localTCF"
+	T38TransferredTCF        = "transferredTCF"
+	T38UDPNoEC               = "t38UDPNoEC"
+	T38UDPRedundancy         = "t38UDPRedundancy"
+	T38UDPFEC                = "t38UDPFEC"
+	t38DefaultMaxBitRate     = 14400
+	t38DefaultRateManagement = T38TransferredTCF
+)
+
+// T38Params holds the T.38 session parameters of an image media line.
+// Zero values mean the parameter is not signalled.
+type T38Params struct {
+	Version         int
+	MaxBitRate      int
+	RateManagement  string // localTCF or transferredTCF
+	MaxBuffer       int
+	MaxDatagram     int
+	UdpEC           string // t38UDPNoEC, t38UDPRedundancy or t38UDPFEC
+	FillBitRemoval  bool
+	TranscodingMMR  bool
+	TranscodingJBIG bool
+}
+
+// IsT38 reports whether the media is an active T.38 fax line over UDPTL or UDP/TLS/UDPTL.
+func (m *Media) IsT38() bool {
+	if m.Type != Image || m.Port <= 0 || !strings.EqualFold(m.FormatDescr, T38FormatDescr) {
+		return false
+	}
+	return strings.EqualFold(m.Proto, Udptl) || strings.EqualFold(m.Proto, UdpTlsUdptl)
+}
+
+// GetT38MediaFlow returns the first active T.38 media line.
+func (ses *Session) GetT38MediaFlow() *Media {
+	for _, media := range ses.Media {
+		if media.IsT38() {
+			return media
+		}
+	}
+	return nil
+}
+
+// T38Params parses the T.38 attributes of the media. Attribute names are matched case-insensitively;
+// boolean flags may appear bare or with a value of 0 or 1.
+func (m *Media) T38Params() (*T38Params, error) {
+	p := new(T38Params)
+	var err error
+	for _, a := range m.Attributes {
+		name, value := a.Name, a.Value
+		switch {
+		case strings.EqualFold(name, T38FaxVersion):
+			p.Version, err = strconv.Atoi(value)
+		case strings.EqualFold(name, T38MaxBitRate):
+			p.MaxBitRate, err = strconv.Atoi(value)
+		case strings.EqualFold(name, T38FaxRateManagement):
+			p.RateManagement = value
+		case strings.EqualFold(name, T38FaxMaxBuffer):
+			p.MaxBuffer, err = strconv.Atoi(value)
+		case strings.EqualFold(name, T38FaxMaxDatagram):
+			p.MaxDatagram, err = strconv.Atoi(value)
+		case strings.EqualFold(name, T38FaxUdpEC):
+			p.UdpEC = value
+		case strings.EqualFold(name, T38FaxFillBitRemoval):
+			p.FillBitRemoval = value != "0"
+		case strings.EqualFold(name, T38FaxTranscodingMMR):
+			p.TranscodingMMR = value != "0"
+		case strings.EqualFold(name, T38FaxTranscodingJBIG):
+			p.TranscodingJBIG = value != "0"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid T.38 attribute %s: %w", a, err)
+		}
+	}
+	return p, nil
+}
+
+// SetT38Params replaces the T.38 attributes of the media with p, keeping other attributes.
+func (m *Media) SetT38Params(p *T38Params) {
+	m.Attributes = deleteT38Attrs(m.Attributes)
+	m.Attributes = append(m.Attributes, p.Attributes()...)
+}
+
+func deleteT38Attrs(attrs Attributes) Attributes {
+	n := 0
+	for _, a := range attrs {
+		if isT38Attr(a.Name) {
+			continue
+		}
+		attrs[n] = a
+		n++
+	}
+	return attrs[:n]
+}
+
+func isT38Attr(name string) bool {
+	return len(name) > 3 && strings.EqualFold(name[:3], "t38")
+}
+
+// Attributes returns the T.38 parameters as attributes in their conventional order and spelling.
+func (p *T38Params) Attributes() Attributes {
+	attrs := make(Attributes, 0, 9)
+	attrs = append(attrs, NewAttr(T38FaxVersion, strconv.Itoa(p.Version)))
+	if p.MaxBitRate > 0 {
+		attrs = append(attrs, NewAttr(T38MaxBitRate, strconv.Itoa(p.MaxBitRate)))
+	}
+	if p.FillBitRemoval {
+		attrs = append(attrs, NewAttrFlag(T38FaxFillBitRemoval))
+	}
+	if p.TranscodingMMR {
+		attrs = append(attrs, NewAttrFlag(T38FaxTranscodingMMR))
+	}
+	if p.TranscodingJBIG {
+		attrs = append(attrs, NewAttrFlag(T38FaxTranscodingJBIG))
+	}
+	if p.RateManagement != "" {
+		attrs = append(attrs, NewAttr(T38FaxRateManagement, p.RateManagement))
+	}
+	if p.MaxBuffer > 0 {
+		attrs = append(attrs, NewAttr(T38FaxMaxBuffer, strconv.Itoa(p.MaxBuffer)))
+	}
+	if p.MaxDatagram > 0 {
+		attrs = append(attrs, NewAttr(T38FaxMaxDatagram, strconv.Itoa(p.MaxDatagram)))
+	}
+	if p.UdpEC != "" {
+		attrs = append(attrs, NewAttr(T38FaxUdpEC, p.UdpEC))
+	}
+	return attrs
+}
+
+// udpECRank orders error correction schemes by capability.
+func udpECRank(ec string) int {
+	switch {
+	case strings.EqualFold(ec, T38UDPFEC):
+		return 2
+	case strings.EqualFold(ec, T38UDPRedundancy):
+		return 1
+	}
+	return 0
+}
+
+// NegotiateT38 builds the answer parameters to the offered ones, lowering version, bitrate, buffer
+// and datagram sizes and error correction to the local limits. Rate management is echoed as offered.
+// Optional features are only kept when both sides support them.
+func NegotiateT38(offer, local *T38Params) *T38Params {
+	answer := &T38Params{
+		Version:         min(offer.Version, local.Version),
+		MaxBitRate:      minPositive(offer.MaxBitRate, local.MaxBitRate),
+		RateManagement:  offer.RateManagement,
+		MaxBuffer:       minPositive(offer.MaxBuffer, local.MaxBuffer),
+		MaxDatagram:     minPositive(offer.MaxDatagram, local.MaxDatagram),
+		FillBitRemoval:  offer.FillBitRemoval && local.FillBitRemoval,
+		TranscodingMMR:  offer.TranscodingMMR && local.TranscodingMMR,
+		TranscodingJBIG: offer.TranscodingJBIG && local.TranscodingJBIG,
+	}
+	if answer.MaxBitRate == 0 {
+		answer.MaxBitRate = t38DefaultMaxBitRate
+	}
+	if answer.RateManagement == "" {
+		answer.RateManagement = t38DefaultRateManagement
+	}
+	if offer.UdpEC != "" {
+		answer.UdpEC = offer.UdpEC
+		if local.UdpEC != "" && udpECRank(local.UdpEC) < udpECRank(offer.UdpEC) {
+			answer.UdpEC = local.UdpEC
+		}
+	}
+	return answer
+}
+
+func minPositive(a, b int) int {
+	switch {
+	case a <= 0:
+		return max(b, 0)
+	case b <= 0:
+		return a
+	}
+	return min(a, b)
+}
+
+// NegotiateT38 rewrites the T.38 attributes of an offered image media line into the answer
+// parameters for the local limits.
+func (m *Media) NegotiateT38(local *T38Params) error {
+	if !m.IsT38() {
+		return fmt.Errorf("cannot negotiate T.38: media is not an active T.38 line")
+	}
+	offer, err := m.T38Params()
+	if err != nil {
+		return err
+	}
+	m.SetT38Params(NegotiateT38(offer, local))
+	return nil
+}
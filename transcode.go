@@ -0,0 +1,205 @@
+package sdp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type MediaAction string
+type DTMFInterworking string
+
+const (
+	ActionPassthrough MediaAction = "passthrough"
+	ActionTranscode   MediaAction = "transcode"
+	ActionReject      MediaAction = "reject"
+
+	DTMFNone        DTMFInterworking = "none"        // no leg offers RFC 4733
+	DTMFPassthrough DTMFInterworking = "passthrough" // RFC 4733 on both legs with the same clock rate
+	DTMFRetime      DTMFInterworking = "retime"      // RFC 4733 on both legs with different clock rates
+	DTMFToInband    DTMFInterworking = "rfc4733-to-inband"
+	DTMFFromInband  DTMFInterworking = "inband-to-rfc4733"
+)
+
+// TranscodeCosts is the configurable cost table used to pick a transcoding pair; lower is better.
+// A missing family pair means transcoding between those families is not possible.
+type TranscodeCosts struct {
+	Families map[CodecFamily]map[CodecFamily]int
+	Resample int // added when clock rates differ
+}
+
+// DefaultTranscodeCosts favours waveform codecs and penalises tandem compression.
+var DefaultTranscodeCosts = &TranscodeCosts{
+	Families: map[CodecFamily]map[CodecFamily]int{
+		FamilyWaveform:  {FamilyWaveform: 1, FamilyLossless: 2, FamilyHybrid: 3, FamilyCELP: 4, FamilyTransform: 4, FamilyVocoder: 5},
+		FamilyLossless:  {FamilyWaveform: 2, FamilyLossless: 1, FamilyHybrid: 3, FamilyCELP: 4, FamilyTransform: 4, FamilyVocoder: 5},
+		FamilyHybrid:    {FamilyWaveform: 3, FamilyLossless: 3, FamilyHybrid: 4, FamilyCELP: 6, FamilyTransform: 6, FamilyVocoder: 7},
+		FamilyCELP:      {FamilyWaveform: 4, FamilyLossless: 4, FamilyHybrid: 6, FamilyCELP: 8, FamilyTransform: 8, FamilyVocoder: 9},
+		FamilyTransform: {FamilyWaveform: 4, FamilyLossless: 4, FamilyHybrid: 6, FamilyCELP: 8, FamilyTransform: 6, FamilyVocoder: 9},
+		FamilyVocoder:   {FamilyWaveform: 5, FamilyLossless: 5, FamilyHybrid: 7, FamilyCELP: 9, FamilyTransform: 9, FamilyVocoder: 10},
+	},
+	Resample: 1,
+}
+
+// Cost returns the cost of transcoding from a to b, and false if it is not possible.
+func (tc *TranscodeCosts) Cost(a, b *Format) (int, bool) {
+	fa, fb := formatFamily(a), formatFamily(b)
+	costs, ok := tc.Families[fa]
+	if !ok {
+		return 0, false
+	}
+	cost, ok := costs[fb]
+	if !ok {
+		return 0, false
+	}
+	if a.ClockRate != b.ClockRate {
+		cost += tc.Resample
+	}
+	return cost, true
+}
+
+func formatFamily(f *Format) CodecFamily {
+	if cinfo, ok := GetCodecByName(f.Name); ok {
+		return cinfo.Family
+	}
+	return FamilyOther
+}
+
+// MediaPlan is the media-server decision for one m-line of leg A.
+type MediaPlan struct {
+	Index  int
+	Type   string
+	Action MediaAction
+	From   *Format // leg A format
+	To     *Format // leg B format
+	Cost   int
+	DTMF   DTMFInterworking
+}
+
+func (p *MediaPlan) String() string {
+	switch p.Action {
+	case ActionPassthrough:
+		if p.From == nil {
+			return fmt.Sprintf("%s: passthrough", p.Type)
+		}
+		return fmt.Sprintf("%s: passthrough %s, dtmf %s", p.Type, p.From.Name, p.DTMF)
+	case ActionTranscode:
+		return fmt.Sprintf("%s: transcode %s -> %s, dtmf %s", p.Type, p.From.Name, p.To.Name, p.DTMF)
+	default:
+		return fmt.Sprintf("%s: reject", p.Type)
+	}
+}
+
+// NeedsMediaServer reports whether any plan requires transcoding or DTMF interworking.
+func NeedsMediaServer(plans []*MediaPlan) bool {
+	for _, p := range plans {
+		if p.Action == ActionTranscode {
+			return true
+		}
+		switch p.DTMF {
+		case DTMFRetime, DTMFToInband, DTMFFromInband:
+			return true
+		}
+	}
+	return false
+}
+
+// PlanTranscoding decides per m-line of the offer from leg A whether media can be passed through to
+// leg B (given as its answer or its capabilities) or which transcoding pair to use.
+// If costs is nil DefaultTranscodeCosts is used.
+func PlanTranscoding(offer, legB *Session, costs *TranscodeCosts) ([]*MediaPlan, error) {
+	if offer == nil || legB == nil {
+		return nil, fmt.Errorf("cannot plan transcoding: nil session")
+	}
+	if costs == nil {
+		costs = DefaultTranscodeCosts
+	}
+	plans := make([]*MediaPlan, len(offer.Media))
+	for i, ma := range offer.Media {
+		plans[i] = planMedia(ma, counterpartMedia(legB, i, ma.Type), costs)
+		plans[i].Index = i
+	}
+	return plans, nil
+}
+
+// counterpartMedia returns the m-line of ses at the same index, or the first one of the same type.
+func counterpartMedia(ses *Session, i int, medType string) *Media {
+	if i < len(ses.Media) && ses.Media[i].Type == medType {
+		return ses.Media[i]
+	}
+	return ses.GetMediaFlow(medType)
+}
+
+func planMedia(ma, mb *Media, costs *TranscodeCosts) *MediaPlan {
+	plan := &MediaPlan{Type: ma.Type, Action: ActionReject, DTMF: DTMFNone}
+	if mb == nil || ma.Port == 0 || mb.Port == 0 {
+		return plan
+	}
+	if len(ma.Formats) == 0 || len(mb.Formats) == 0 {
+		if ma.Proto == mb.Proto && strings.EqualFold(ma.FormatDescr, mb.FormatDescr) {
+			plan.Action = ActionPassthrough
+		}
+		return plan
+	}
+
+	codecsA, codecsB := transcodableFormats(ma), transcodableFormats(mb)
+
+	found := false
+	for _, fa := range codecsA {
+		for _, fb := range codecsB {
+			if matchFormats(fa, fb) {
+				plan.Action, plan.From, plan.To = ActionPassthrough, fa, fb
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		best := -1
+		for _, fa := range codecsA {
+			for _, fb := range codecsB {
+				cost, ok := costs.Cost(fa, fb)
+				if ok && (best < 0 || cost < best) {
+					best = cost
+					plan.Action, plan.From, plan.To, plan.Cost = ActionTranscode, fa, fb, cost
+				}
+			}
+		}
+	}
+
+	if plan.Action == ActionReject || ma.Type != Audio {
+		return plan
+	}
+
+	teA, teB := ma.GetFirstRFC4733(), mb.GetFirstRFC4733()
+	switch {
+	case teA != nil && teB != nil:
+		if teA.ClockRate == teB.ClockRate {
+			plan.DTMF = DTMFPassthrough
+		} else {
+			plan.DTMF = DTMFRetime
+		}
+	case teA != nil:
+		plan.DTMF = DTMFToInband
+	case teB != nil:
+		plan.DTMF = DTMFFromInband
+	}
+
+	return plan
+}
+
+// transcodableFormats returns media codecs in preference order, skipping DTMF, CN, RED and RTX.
+func transcodableFormats(m *Media) []*Format {
+	formats := make([]*Format, 0, len(m.Formats))
+	for _, f := range m.Formats {
+		f = resolveStatic(f)
+		if !f.IsAudioFormat() || isReferencingFormat(f) {
+			continue
+		}
+		formats = append(formats, f)
+	}
+	return formats
+}
@@ -0,0 +1,174 @@
+package sdp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Severity is the severity of a validation finding.
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // tolerated by most implementations
+	SeverityError                   // violates RFC 8866 or RFC 3264
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Violation is a single validation finding. Line is the 1-based line number of the offending (or,
+// for missing lines, the enclosing) line when decoding, 0 when unknown. Path locates the element
+// as in Diff, e.g. "media[1]".
+type Violation struct {
+	Severity Severity
+	Line     int
+	Path     string
+	Message  string
+}
+
+func (v *Violation) String() string {
+	var b strings.Builder
+	b.WriteString(v.Severity.String())
+	if v.Line > 0 {
+		b.WriteString(": line " + strconv.Itoa(v.Line))
+	}
+	if v.Path != "" {
+		b.WriteString(" (" + v.Path + ")")
+	}
+	b.WriteString(": " + v.Message)
+	return b.String()
+}
+
+// ValidationError is returned by a strict Decoder when the description has errors.
+type ValidationError struct {
+	Violations []*Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Sprintf("sdp: %d violation(s): %s", len(e.Violations), strings.Join(msgs, "; "))
+}
+
+// HasErrors reports whether any violation is an error.
+func HasErrors(violations []*Violation) bool {
+	return slices.ContainsFunc(violations, func(v *Violation) bool { return v.Severity == SeverityError })
+}
+
+// Validate checks the description against RFC 8866 and returns every violation found: missing origin,
+// media without connection, dynamic payload types without rtpmap, payload types above 127, conflicting
+// direction attributes, invalid ports, formats not matching the transport protocol and invalid bandwidths.
+func (ses *Session) Validate() []*Violation {
+	v := &validator{}
+	v.session(ses)
+	return v.violations
+}
+
+type validator struct {
+	violations []*Violation
+	mediaLines []int // line numbers of the m= lines, when decoded
+}
+
+func (v *validator) add(sev Severity, line int, path, format string, args ...any) {
+	v.violations = append(v.violations, &Violation{Severity: sev, Line: line, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) mediaLine(i int) int {
+	if i < len(v.mediaLines) {
+		return v.mediaLines[i]
+	}
+	return 0
+}
+
+func (v *validator) session(ses *Session) {
+	if ses.Version != 0 {
+		v.add(SeverityError, 0, "session.version", "unsupported protocol version %d", ses.Version)
+	}
+	if ses.Origin == nil {
+		v.add(SeverityError, 0, "session.origin", "missing o= line")
+	}
+	v.directions(0, "session", ses.Mode, ses.Attributes)
+	v.bandwidths(0, "session", ses.Bandwidth)
+	for i, m := range ses.Media {
+		v.media(ses, v.mediaLine(i), fmt.Sprintf("media[%d]", i), m)
+	}
+}
+
+func (v *validator) media(ses *Session, line int, path string, m *Media) {
+	if m.Port < 0 || m.Port > 65535 {
+		v.add(SeverityError, line, path, "port %d out of range", m.Port)
+	}
+	if m.PortNum < 0 || m.PortNum > 0 && m.Port+m.PortNum-1 > 65535 {
+		v.add(SeverityError, line, path, "port count %d out of range", m.PortNum)
+	}
+	if m.Port > 0 && ses.Connection == nil && len(m.Connection) == 0 {
+		v.add(SeverityError, line, path, "active %s media without connection", m.Type)
+	}
+	v.formats(line, path, m)
+	v.directions(line, path, m.Mode, m.Attributes)
+	v.bandwidths(line, path, m.Bandwidth)
+}
+
+func (v *validator) formats(line int, path string, m *Media) {
+	switch {
+	case m.Proto == "":
+		v.add(SeverityError, line, path, "missing transport protocol")
+	case isRTP(m.Type, m.Proto):
+		if m.FormatDescr != "" {
+			v.add(SeverityError, line, path, "non-numeric format %q for %s", m.FormatDescr, m.Proto)
+		}
+		if len(m.Formats) == 0 {
+			v.add(SeverityError, line, path, "no payload type for %s", m.Proto)
+		}
+	case len(m.Formats) > 0:
+		v.add(SeverityError, line, path, "payload types for non-RTP protocol %s", m.Proto)
+	case m.FormatDescr == "":
+		v.add(SeverityError, line, path, "empty format list")
+	case strings.Contains(m.Proto, "RTP/"):
+		for _, f := range strings.Fields(m.FormatDescr) {
+			if pt, err := strconv.Atoi(f); err != nil || pt < 0 || pt > 127 {
+				v.add(SeverityError, line, path, "invalid payload type %q for %s", f, m.Proto)
+			}
+		}
+	}
+
+	for _, f := range m.Formats {
+		fpath := path + ".formats[pt=" + strconv.Itoa(int(f.Payload)) + "]"
+		switch {
+		case f.Payload > 127:
+			v.add(SeverityError, line, fpath, "payload type %d out of range 0-127", f.Payload)
+		case f.Payload >= 96 && f.Name == "":
+			v.add(SeverityError, line, fpath, "dynamic payload type %d without rtpmap", f.Payload)
+		}
+	}
+}
+
+func (v *validator) directions(line int, path, mode string, attrs Attributes) {
+	for _, a := range attrs {
+		switch a.Name {
+		case Inactive, RecvOnly, SendOnly, SendRecv:
+			if mode != "" && mode != a.Name {
+				v.add(SeverityError, line, path, "conflicting direction attributes %s and %s", mode, a.Name)
+			} else if mode == a.Name {
+				v.add(SeverityWarning, line, path, "duplicate direction attribute %s", a.Name)
+			}
+			mode = a.Name
+		}
+	}
+}
+
+func (v *validator) bandwidths(line int, path string, bws []*Bandwidth) {
+	for _, b := range bws {
+		if err := b.Validate(); err != nil {
+			v.add(SeverityWarning, line, path, "%v", err)
+		}
+	}
+}
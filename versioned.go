@@ -0,0 +1,70 @@
+package sdp
+
+import "fmt"
+
+// VersionedSession is a local description whose origin version is managed on encode: it is
+// incremented if and only if the content changed since the last encoded description (RFC 3264 §8).
+type VersionedSession struct {
+	ses  *Session
+	sent *Session
+}
+
+// NewVersionedSession returns a versioned session for the local description ses.
+func NewVersionedSession(ses *Session) *VersionedSession {
+	return &VersionedSession{ses: ses}
+}
+
+// Session returns the local description, to be modified in place between encodes.
+func (vs *VersionedSession) Session() *Session {
+	return vs.ses
+}
+
+// Update sets the origin version to the last encoded one, incremented when the content changed,
+// ignoring the version itself. It reports whether the content changed.
+func (vs *VersionedSession) Update() (bool, error) {
+	if vs.ses.Origin == nil {
+		return false, fmt.Errorf("cannot update session version: missing origin")
+	}
+	if vs.sent == nil {
+		return true, nil
+	}
+	changed := !vs.ses.EqualsWith(vs.sent, IgnoreOriginVersion())
+	vs.ses.Origin.SessionVersion = vs.sent.Origin.SessionVersion
+	if changed {
+		vs.ses.Origin.SessionVersion++
+	}
+	return changed, nil
+}
+
+// Encode updates the origin version and encodes the description, remembering it as sent once encoded.
+func (vs *VersionedSession) Encode(e *Encoder) error {
+	if _, err := vs.Update(); err != nil {
+		return err
+	}
+	if err := e.Encode(vs.ses); err != nil {
+		return err
+	}
+	vs.sent = vs.ses.Clone()
+	return nil
+}
+
+// Bytes updates the origin version and returns the encoded description, remembering it as sent.
+func (vs *VersionedSession) Bytes() ([]byte, error) {
+	e := NewEncoder(nil)
+	if err := vs.Encode(e); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// String updates the origin version and returns the description as Bytes would encode it,
+// without remembering it as sent.
+func (vs *VersionedSession) String() string {
+	vs.Update() // without an origin, there is no version to update
+	return vs.ses.String()
+}
+
+// Sent returns the last encoded description, or nil if none was encoded yet.
+func (vs *VersionedSession) Sent() *Session {
+	return vs.sent
+}